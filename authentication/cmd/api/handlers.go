@@ -1,17 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
-	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/ziliscite/go-micro-authentication/internal/data"
 	"github.com/ziliscite/go-micro-authentication/internal/repository"
 	"log/slog"
 	"net/http"
+	"time"
 )
 
 func (app *application) register(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +42,8 @@ func (app *application) register(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), repository.DBTimeout)
 	defer cancel()
 
-	err = app.repo.Insert(ctx, &user)
+	// the request ID ties the user.registered event to this request
+	err = app.repo.Insert(ctx, &user, middleware.GetReqID(r.Context()))
 	if err != nil {
 		var pgErr *pgconn.PgError
 		switch {
@@ -83,6 +83,11 @@ func (app *application) authenticate(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
+			app.audit(ctx, r, data.LoginFailedEvent, data.LoginFailed{
+				Email:  request.Email,
+				Reason: data.LoginUnknownEmail,
+				Client: clientOf(r),
+			})
 			app.invalidCredentials(w)
 		default:
 			app.serverError(w, err)
@@ -92,54 +97,252 @@ func (app *application) authenticate(w http.ResponseWriter, r *http.Request) {
 
 	valid, err := user.Password.PasswordMatches(request.Password)
 	if err != nil || !valid {
+		app.audit(ctx, r, data.LoginFailedEvent, data.LoginFailed{
+			UserID: user.ID,
+			Email:  user.Email,
+			Reason: data.LoginWrongPassword,
+			Client: clientOf(r),
+		})
 		app.invalidCredentials(w)
 		return
 	}
 
-	// I assume this will be changed to some pub sub and call grpc stuff
-	err = app.log("Authenticated", fmt.Sprintf("%s authenticated successfully", user.Email))
+	// after the password, only someone who knows it learns the account is inactive
+	if !user.Active {
+		app.audit(ctx, r, data.LoginFailedEvent, data.LoginFailed{
+			UserID: user.ID,
+			Email:  user.Email,
+			Reason: data.LoginInactiveUser,
+			Client: clientOf(r),
+		})
+		app.inactiveAccount(w)
+		return
+	}
+
+	app.audit(ctx, r, data.LoginSucceededEvent, data.LoginSucceeded{
+		UserID: user.ID,
+		Email:  user.Email,
+		Client: clientOf(r),
+	})
+
+	refresh, err := data.NewRefreshToken(user.ID, "", app.cfg.JWT.RefreshTTL)
 	if err != nil {
-		// don't do anything. why would we want to make it error here?
-		// user is authenticated, a missing log aint doin shit
-		slog.Error("Failed to log authentication", "error", err)
+		app.serverError(w, err)
+		return
+	}
+
+	if err = app.repo.InsertRefreshToken(ctx, refresh); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tokens, err := app.issueTokens(user, refresh)
+	if err != nil {
+		app.serverError(w, err)
+		return
 	}
 
 	if err = app.write(w, http.StatusAccepted, response{
 		Error:   false,
 		Message: "Authenticated",
-		Data:    user,
+		Data:    tokens,
 	}); err != nil {
 		app.serverError(w, err)
 	}
 }
 
-func (app *application) log(title, content string) error {
-	var entry struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
+// resetPassword changes the password of a user who knows the current one.
+func (app *application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email       string `json:"email"`
+		Password    string `json:"password"`
+		NewPassword string `json:"new_password"`
 	}
 
-	entry.Title = title
-	entry.Content = content
+	err := app.readBody(w, r, &request)
+	if err != nil {
+		app.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if request.NewPassword == "" {
+		app.error(w, http.StatusBadRequest, errors.New("new_password must be provided"))
+		return
+	}
 
-	payload, err := json.Marshal(entry)
+	ctx, cancel := context.WithTimeout(r.Context(), repository.DBTimeout)
+	defer cancel()
+
+	user, err := app.repo.GetByEmail(ctx, request.Email)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			app.invalidCredentials(w)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	valid, err := user.Password.PasswordMatches(request.Password)
+	if err != nil || !valid {
+		app.invalidCredentials(w)
+		return
+	}
+
+	if !user.Active {
+		app.inactiveAccount(w)
+		return
+	}
+
+	if err = user.Password.Set(request.NewPassword); err != nil {
+		app.serverError(w, err)
+		return
 	}
 
-	req, err := http.NewRequest(http.MethodPost, "http://logger/v1/logs", bytes.NewBuffer(payload))
-	// url is composed of [hostname]:[port]/[service name in the docker image]/[method]
+	// the request ID ties the auth.password.reset event to this request
+	err = app.repo.ResetPassword(ctx, user, middleware.GetReqID(r.Context()))
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.error(w, http.StatusConflict, errors.New("the user was changed while the password was being reset, please try again"))
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if err = app.write(w, http.StatusAccepted, response{
+		Error:   false,
+		Message: "Password Reset",
+	}); err != nil {
+		app.serverError(w, err)
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// errInactiveUser stops the tokens of a deactivated user from being refreshed.
+var errInactiveUser = errors.New("user account is not active")
 
-	resp, err := http.DefaultClient.Do(req)
+func (app *application) refresh(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readBody(w, r, &request)
+	if err != nil {
+		app.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	next, err := data.NewRefreshToken(0, "", app.cfg.JWT.RefreshTTL)
 	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), repository.DBTimeout)
+	defer cancel()
+
+	// the tokens are issued before the rotation commits, a client never loses the old token
+	// without getting the new one
+	var tokens *authenticated
+	err = app.repo.RotateRefreshToken(ctx, data.HashToken(request.RefreshToken), next, func(user *data.User) error {
+		if !user.Active {
+			return errInactiveUser
+		}
+
+		var err error
+		tokens, err = app.issueTokens(user, next)
 		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTokenReused):
+			slog.Warn("Refresh token reuse detected, family revoked", "user_id", next.UserID)
+			app.invalidRefreshToken(w)
+		case errors.Is(err, repository.ErrTokenNotFound), errors.Is(err, repository.ErrTokenExpired),
+			errors.Is(err, sql.ErrNoRows):
+			app.invalidRefreshToken(w)
+		case errors.Is(err, errInactiveUser):
+			app.inactiveAccount(w)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if err = app.write(w, http.StatusOK, response{
+		Error:   false,
+		Message: "Token Refreshed",
+		Data:    tokens,
+	}); err != nil {
+		app.serverError(w, err)
+	}
+}
+
+func (app *application) logout(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readBody(w, r, &request)
+	if err != nil {
+		app.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), repository.DBTimeout)
+	defer cancel()
+
+	err = app.repo.RevokeRefreshToken(ctx, data.HashToken(request.RefreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTokenNotFound):
+			app.invalidRefreshToken(w)
+		default:
+			app.serverError(w, err)
+		}
+		return
 	}
-	defer resp.Body.Close()
 
-	return nil
+	if err = app.write(w, http.StatusOK, response{
+		Error:   false,
+		Message: "Logged Out",
+	}); err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// authenticated is what a successful login or refresh returns.
+type authenticated struct {
+	User        *data.User `json:"user"`
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	*data.RefreshToken
+}
+
+func (app *application) issueTokens(user *data.User, refresh *data.RefreshToken) (*authenticated, error) {
+	accessToken, expiry, err := app.tokens.Issue(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authenticated{
+		User:         user,
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiry,
+		RefreshToken: refresh,
+	}, nil
+}
+
+// jwks serves the public keys other services need to verify our access tokens.
+func (app *application) jwks(w http.ResponseWriter, r *http.Request) {
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	if err := app.write(w, http.StatusOK, app.tokens.JWKS(), headers); err != nil {
+		app.serverError(w, err)
+	}
 }
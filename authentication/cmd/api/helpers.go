@@ -73,6 +73,16 @@ func (app *application) invalidCredentials(w http.ResponseWriter) {
 	app.error(w, http.StatusUnauthorized, errors.New(message))
 }
 
+func (app *application) invalidRefreshToken(w http.ResponseWriter) {
+	message := "invalid or expired refresh token"
+	app.error(w, http.StatusUnauthorized, errors.New(message))
+}
+
+func (app *application) inactiveAccount(w http.ResponseWriter) {
+	message := "your user account must be activated to access this resource"
+	app.error(w, http.StatusForbidden, errors.New(message))
+}
+
 func (app *application) readBody(w http.ResponseWriter, r *http.Request, dst any) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
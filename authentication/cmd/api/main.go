@@ -1,56 +1,101 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"github.com/ziliscite/go-micro-authentication/internal/config"
+	"github.com/ziliscite/go-micro-authentication/internal/event"
 	"github.com/ziliscite/go-micro-authentication/internal/repository"
+	"github.com/ziliscite/go-micro-authentication/internal/token"
 	"log/slog"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
-type config struct {
-	port string
-	dsn  string
-}
-
 type application struct {
-	cfg  config
-	repo repository.Repository
+	cfg       config.Config
+	repo      repository.Repository
+	tokens    *token.Issuer
+	publisher *event.Publisher
 }
 
 func main() {
-	cfg := config{
-		port: "80",
-		dsn:  os.Getenv("DB_DSN"),
+	// Stop on ctrl-c and on docker's SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var cfg config.Config
+	if err := config.Load(&cfg, os.Args[1:]); err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Loaded configuration", "config", config.Redacted(cfg))
+
+	tokens, err := openIssuer(cfg)
+	if err != nil {
+		slog.Error("Failed to load signing key", "error", err)
+		os.Exit(1)
 	}
 
-	db, err := openDB(cfg.dsn)
+	db, err := openDB(cfg.DSN)
 	if err != nil {
 		slog.Error(err.Error())
 		os.Exit(1)
 	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			slog.Error("Failed to close the database pool", "error", err)
+		}
+	}()
 
 	repo := repository.New(db)
 
-	app := application{
-		cfg:  cfg,
-		repo: repo,
+	// Connect to rabbitmq, the connection is re-dialed in the background whenever it drops
+	conn, err := event.Dial(cfg.AMQP.URL)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
+	defer conn.Close()
 
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", cfg.port),
-		Handler: app.routes(),
+	// events are relayed one at a time to keep them in order
+	publisher, err := event.NewPublisher(conn, 1, cfg.AMQP.ConfirmTimeout)
+	if err != nil {
+		slog.Error("Failed to create publisher", "error", err)
+		os.Exit(1)
 	}
+	defer publisher.Close()
 
-	slog.Info("Starting authentication service", "port", cfg.port)
-	if err = server.ListenAndServe(); err != nil {
-		slog.Error("Failed to start server", "error", err)
+	app := application{
+		cfg:       cfg,
+		repo:      repo,
+		tokens:    tokens,
+		publisher: publisher,
+	}
+
+	relayed := make(chan struct{})
+	go func() {
+		defer close(relayed)
+		app.relayOutbox(ctx)
+	}()
+
+	// Requests in flight are drained before the deferred database pool is closed
+	err = app.serve(ctx)
+
+	// whatever the relay didn't get to is picked up on the next start
+	<-relayed
+
+	if err != nil {
+		slog.Error("Server stopped with an error", "error", err)
 		os.Exit(1)
 	}
+
+	slog.Info("Authentication service stopped")
 }
 
 func openDB(dsn string) (*sql.DB, error) {
@@ -71,3 +116,24 @@ func openDB(dsn string) (*sql.DB, error) {
 	slog.Info("Connected to authentication database")
 	return db, nil
 }
+
+func openIssuer(cfg config.Config) (*token.Issuer, error) {
+	if cfg.JWT.PrivateKey == "" {
+		// no key configured, tokens will be invalidated on every restart
+		slog.Warn("JWT_PRIVATE_KEY is not set, generating an ephemeral signing key")
+
+		key, err := token.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+
+		return token.NewIssuer(key, cfg.JWT.Issuer, cfg.JWT.TTL), nil
+	}
+
+	key, err := token.ParsePrivateKey([]byte(cfg.JWT.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return token.NewIssuer(key, cfg.JWT.Issuer, cfg.JWT.TTL), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ziliscite/go-micro-authentication/internal/data"
+	"github.com/ziliscite/go-micro-authentication/internal/event"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// relayOutbox publishes the events waiting in the outbox until ctx is done.
+func (app *application) relayOutbox(ctx context.Context) {
+	ticker := time.NewTicker(app.cfg.Outbox.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// keep going while there's a backlog, full batches mean there may be more
+		for {
+			sent, err := app.repo.RelayOutbox(ctx, app.cfg.Outbox.BatchSize, app.cfg.Outbox.Lease, app.publishEvent)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Failed to relay outbox", "sent", sent, "error", err)
+			}
+
+			if err != nil || sent < app.cfg.Outbox.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// audit records an auth event for the listener to keep. Like every event it's published in the
+// background by the relay, failing to record it doesn't fail the request.
+func (app *application) audit(ctx context.Context, r *http.Request, typ string, payload any) {
+	if err := app.repo.RecordEvent(ctx, typ, middleware.GetReqID(r.Context()), payload); err != nil {
+		slog.Error("Failed to record auth event", "type", typ, "error", err)
+	}
+}
+
+// clientOf tells who made the request, for the audit log.
+func clientOf(r *http.Request) data.Client {
+	return data.Client{
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+}
+
+// publishEvent publishes e, waiting for rabbitmq to confirm it. An event no queue is bound for
+// fails with event.ErrUnroutable, the relay parks it.
+func (app *application) publishEvent(ctx context.Context, e event.Envelope) error {
+	err := app.publisher.Publish(ctx, e)
+	if errors.Is(err, event.ErrUnroutable) {
+		slog.Warn("No queue is bound for event, parking it in the outbox", "type", e.Type, "id", e.ID)
+	}
+
+	return err
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -21,15 +25,59 @@ func (app *application) routes() http.Handler {
 			AllowCredentials: true,
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		}),
+		// honours X-Request-Id, and becomes the correlation ID of the events we publish
+		middleware.RequestID,
 		middleware.Logger,
 		middleware.Recoverer,
 		middleware.Heartbeat("/ping"),
 	)
 
+	mux.Get("/.well-known/jwks.json", app.jwks)
+
 	mux.Route("/v1", func(v1 chi.Router) {
 		v1.Post("/register", app.register)
 		v1.Post("/authenticate", app.authenticate)
+		v1.Post("/refresh", app.refresh)
+		v1.Post("/logout", app.logout)
+		v1.Post("/password/reset", app.resetPassword)
 	})
 
 	return middleware.Recoverer(mux)
 }
+
+// serve runs the server until ctx is done, then stops accepting connections and waits for
+// in-flight requests to finish, for at most the shutdown timeout.
+func (app *application) serve(ctx context.Context) error {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", app.cfg.Port),
+		Handler: app.routes(),
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Starting authentication service", "port", app.cfg.Port)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down authentication service", "timeout", app.cfg.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("draining requests: %w", err)
+	}
+
+	// ListenAndServe returns ErrServerClosed right away once Shutdown is called
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package data
+
+import "time"
+
+// Types of the events we publish, they double as routing keys. Everything under auth. is kept
+// by the listener as our audit log.
+const (
+	UserRegisteredEvent = "user.registered"
+
+	LoginSucceededEvent = "auth.login.succeeded"
+	LoginFailedEvent    = "auth.login.failed"
+	PasswordResetEvent  = "auth.password.reset"
+)
+
+// Why a login was refused, see LoginFailed
+const (
+	LoginUnknownEmail  = "unknown_email"
+	LoginWrongPassword = "wrong_password"
+	LoginInactiveUser  = "inactive_user"
+)
+
+// UserRegistered is the payload of a user.registered event, what other services get to know
+// about a new user. Never the password.
+type UserRegistered struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	FirstName    string    `json:"first_name,omitempty"`
+	LastName     string    `json:"last_name,omitempty"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// Client is who made the request an auth event is about.
+type Client struct {
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+}
+
+// LoginSucceeded is the payload of an auth.login.succeeded event.
+type LoginSucceeded struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Client
+}
+
+// LoginFailed is the payload of an auth.login.failed event. UserID is only known when the email was.
+type LoginFailed struct {
+	UserID int    `json:"user_id,omitempty"`
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+	Client
+}
+
+// PasswordReset is the payload of an auth.password.reset event.
+type PasswordReset struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
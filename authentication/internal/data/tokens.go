@@ -0,0 +1,57 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// RefreshToken is one link in a rotation chain. Every token issued from the same login
+// shares a Family, so if an old link is ever replayed we can revoke the whole chain.
+type RefreshToken struct {
+	ID         int        `json:"-"`
+	UserID     int        `json:"-"`
+	Family     string     `json:"-"`
+	Plaintext  string     `json:"refresh_token"`
+	Hash       []byte     `json:"-"`
+	ExpiresAt  time.Time  `json:"refresh_expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	ReplacedBy *int       `json:"-"`
+	CreatedAt  time.Time  `json:"-"`
+}
+
+// NewRefreshToken generates a random token for the user. Passing an empty family starts a new chain.
+//
+// Only the sha256 hash is ever stored, the plaintext is handed to the client once and forgotten.
+func NewRefreshToken(userID int, family string, ttl time.Duration) (*RefreshToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	if family == "" {
+		f := make([]byte, 16)
+		if _, err := rand.Read(f); err != nil {
+			return nil, err
+		}
+		family = hex.EncodeToString(f)
+	}
+
+	plaintext := base64.RawURLEncoding.EncodeToString(b)
+
+	return &RefreshToken{
+		UserID:    userID,
+		Family:    family,
+		Plaintext: plaintext,
+		Hash:      HashToken(plaintext),
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// HashToken returns the value we look refresh tokens up by.
+func HashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
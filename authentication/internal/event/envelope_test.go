@@ -0,0 +1,129 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDecodeCurrent(t *testing.T) {
+	want, err := NewEnvelope("log.INFO", "test", "correlation", map[string]string{"title": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(amqp.Delivery{Body: body})
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if got.ID != want.ID || got.Type != want.Type || got.Version != Version || got.Source != want.Source ||
+		got.CorrelationID != want.CorrelationID || !got.Timestamp.Equal(want.Timestamp) || string(got.Payload) != string(want.Payload) {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeUpgradesUnversioned(t *testing.T) {
+	sent := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	body := []byte(`{"title":"hello","content":"world"}`)
+
+	tests := []struct {
+		name     string
+		delivery amqp.Delivery
+		want     Envelope
+	}{
+		{
+			name: "delivery properties",
+			delivery: amqp.Delivery{
+				Body:          body,
+				MessageId:     "message",
+				RoutingKey:    "log.WARN",
+				Timestamp:     sent,
+				AppId:         "broker",
+				CorrelationId: "correlation",
+			},
+			want: Envelope{
+				ID:            "message",
+				Type:          "log.WARN",
+				Version:       Version,
+				Timestamp:     sent,
+				Source:        "broker",
+				CorrelationID: "correlation",
+				Payload:       body,
+			},
+		},
+		{
+			name:     "bare delivery",
+			delivery: amqp.Delivery{Body: body, RoutingKey: "log.INFO"},
+			want: Envelope{
+				Type:    "log.INFO",
+				Version: Version,
+				Source:  "unknown",
+				Payload: body,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.delivery)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			// a bare delivery gets a fresh ID and is stamped when it's read
+			if tt.want.ID == "" {
+				if got.ID == "" {
+					t.Error("Decode() left the ID empty")
+				}
+				tt.want.ID = got.ID
+			}
+			if tt.want.Timestamp.IsZero() {
+				if got.Timestamp.IsZero() {
+					t.Error("Decode() left the timestamp empty")
+				}
+				tt.want.Timestamp = got.Timestamp
+			}
+
+			if got.ID != tt.want.ID || got.Type != tt.want.Type || got.Version != tt.want.Version ||
+				!got.Timestamp.Equal(tt.want.Timestamp) || got.Source != tt.want.Source ||
+				got.CorrelationID != tt.want.CorrelationID || string(got.Payload) != string(tt.want.Payload) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"not json", `{"id":`, "unexpected end of JSON input"},
+		{"future version", `{"id":"a","type":"log.INFO","version":99,"timestamp":"2024-01-02T03:04:05Z","source":"test","payload":{}}`, "version 99 is newer"},
+		{"missing id", `{"type":"log.INFO","version":1,"timestamp":"2024-01-02T03:04:05Z","source":"test","payload":{}}`, "missing id"},
+		{"missing everything", `{"version":1}`, "missing id, type, timestamp, source, payload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(amqp.Delivery{Body: []byte(tt.body)})
+			if !errors.Is(err, ErrInvalidEnvelope) {
+				t.Fatalf("Decode() error = %v, want ErrInvalidEnvelope", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode() error = %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package event
+
+import amqp "github.com/rabbitmq/amqp091-go"
+
+// Declare exchange for pub/sub
+func declareExchange(channel *amqp.Channel) error {
+	// Declare an exchange
+	return channel.ExchangeDeclare(
+		"logs_topic", // name of the exchange
+		"topic",      // type
+		true,         // durable? yes, it supposed to last
+		false,        // auto-deleted
+		false,        // internal, no, its gonna be used between microservice
+		false,        // no-wait
+		nil,          // arguments
+	)
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ziliscite/go-micro-authentication/internal/event"
+	"slices"
+	"time"
+)
+
+// eventSource is who the events we write claim to come from
+const eventSource = "authentication"
+
+// insertOutbox stores e to be published by RelayOutbox. Called within the transaction of the
+// change e is about, so either both happen or neither does.
+func insertOutbox(ctx context.Context, db execer, e event.Envelope) error {
+	envelope, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO outbox (event_id, type, envelope) VALUES ($1, $2, $3)`
+
+	_, err = db.ExecContext(ctx, stmt, e.ID, e.Type, envelope)
+	return err
+}
+
+// RecordEvent stores an event of the given type for RelayOutbox to publish, for things that
+// happen without changing anything else in the database.
+func (r Repository) RecordEvent(ctx context.Context, typ, correlationID string, payload any) error {
+	e, err := event.NewEnvelope(typ, eventSource, correlationID, payload)
+	if err != nil {
+		return err
+	}
+
+	return insertOutbox(ctx, r.db, e)
+}
+
+// RelayOutbox hands up to limit pending events to publish, oldest first, and marks the ones it
+// accepted as sent. It returns how many were sent.
+//
+// The batch is claimed for lease in a statement of its own, so replicas relaying at the same time
+// never pick the same events, and no transaction stays open while rabbitmq confirms. Publishing
+// is cut off when the lease runs out, before another relay could claim the batch again. It stops
+// at the first failure to keep the order, the rest are released to be tried next time. If we die
+// between publish and marking, the event goes out again once the lease is over, consumers dedup
+// by envelope ID.
+//
+// An event publish fails with event.ErrUnroutable for has no queue bound to it. It's parked
+// with unroutable_at set instead of being sent, clearing it sends the event again.
+func (r Repository) RelayOutbox(ctx context.Context, limit int, lease time.Duration, publish func(ctx context.Context, e event.Envelope) error) (int, error) {
+	query := `
+		UPDATE outbox SET claimed_until = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND unroutable_at IS NULL
+				AND (claimed_until IS NULL OR claimed_until < NOW())
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, envelope
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type pending struct {
+		id       int64
+		envelope event.Envelope
+	}
+
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		var envelope []byte
+		if err = rows.Scan(&p.id, &envelope); err != nil {
+			return 0, err
+		}
+
+		if err = json.Unmarshal(envelope, &p.envelope); err != nil {
+			return 0, err
+		}
+
+		batch = append(batch, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// RETURNING doesn't keep the order of the select
+	slices.SortFunc(batch, func(a, b pending) int {
+		return cmp.Compare(a.id, b.id)
+	})
+
+	publishCtx, cancel := context.WithTimeout(ctx, lease)
+	defer cancel()
+
+	var sent, unroutable, released []int64
+	var publishErr error
+	for i, p := range batch {
+		publishErr = publish(publishCtx, p.envelope)
+		if errors.Is(publishErr, event.ErrUnroutable) {
+			unroutable = append(unroutable, p.id)
+			publishErr = nil
+			continue
+		}
+		if publishErr != nil {
+			for _, rest := range batch[i:] {
+				released = append(released, rest.id)
+			}
+			break
+		}
+		sent = append(sent, p.id)
+	}
+
+	// the batch is done with even if ctx is, ours to mark
+	ctx = context.WithoutCancel(ctx)
+
+	var errs []error
+	if len(sent) > 0 {
+		stmt := `UPDATE outbox SET sent_at = NOW(), claimed_until = NULL WHERE id = ANY($1)`
+		if _, err = r.db.ExecContext(ctx, stmt, sent); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(unroutable) > 0 {
+		stmt := `UPDATE outbox SET unroutable_at = NOW(), claimed_until = NULL WHERE id = ANY($1)`
+		if _, err = r.db.ExecContext(ctx, stmt, unroutable); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(released) > 0 {
+		stmt := `UPDATE outbox SET claimed_until = NULL WHERE id = ANY($1)`
+		if _, err = r.db.ExecContext(ctx, stmt, released); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return 0, errors.Join(append(errs, publishErr)...)
+	}
+
+	return len(sent), publishErr
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ziliscite/go-micro-authentication/internal/data"
+	"time"
+)
+
+var (
+	ErrTokenNotFound = errors.New("refresh token not found")
+	ErrTokenExpired  = errors.New("refresh token expired")
+	ErrTokenReused   = errors.New("refresh token reuse detected")
+)
+
+// InsertRefreshToken stores the hash of a freshly issued refresh token
+func (r Repository) InsertRefreshToken(ctx context.Context, token *data.RefreshToken) error {
+	stmt := `
+		INSERT INTO refresh_tokens (user_id, family, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at
+	`
+
+	return r.db.QueryRowContext(ctx, stmt,
+		token.UserID,
+		token.Family,
+		token.Hash,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+// RotateRefreshToken exchanges the token identified by hash for next, within one transaction.
+//
+// next inherits the user and family of the old token. If the old token was already revoked or
+// replaced, someone is replaying it, so the entire family is revoked and ErrTokenReused is returned.
+//
+// The user of the token is handed to issue before the rotation is committed. If issue fails, or
+// the user is gone (sql.ErrNoRows), nothing changes and the old token can be used again.
+func (r Repository) RotateRefreshToken(ctx context.Context, hash []byte, next *data.RefreshToken, issue func(user *data.User) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, user_id, family, expires_at, revoked_at, replaced_by
+		FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE
+	`
+
+	var current data.RefreshToken
+	if err = tx.QueryRowContext(ctx, query, hash).Scan(
+		&current.ID,
+		&current.UserID,
+		&current.Family,
+		&current.ExpiresAt,
+		&current.RevokedAt,
+		&current.ReplacedBy,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTokenNotFound
+		}
+		return err
+	}
+
+	next.UserID = current.UserID
+	next.Family = current.Family
+
+	if current.RevokedAt != nil || current.ReplacedBy != nil {
+		if err = revokeFamily(ctx, tx, current.Family); err != nil {
+			return err
+		}
+
+		// commit the revocation, the caller still gets rejected
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+
+		return ErrTokenReused
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return ErrTokenExpired
+	}
+
+	user, err := getUser(ctx, tx, current.UserID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO refresh_tokens (user_id, family, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at
+	`
+
+	if err = tx.QueryRowContext(ctx, stmt,
+		next.UserID,
+		next.Family,
+		next.Hash,
+		next.ExpiresAt,
+	).Scan(&next.ID, &next.CreatedAt); err != nil {
+		return err
+	}
+
+	stmt = `UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2`
+	if _, err = tx.ExecContext(ctx, stmt, next.ID, current.ID); err != nil {
+		return err
+	}
+
+	if err = issue(user); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeRefreshToken revokes the family of the token identified by hash, ending that login session
+func (r Repository) RevokeRefreshToken(ctx context.Context, hash []byte) error {
+	var family string
+	query := `SELECT family FROM refresh_tokens WHERE token_hash = $1`
+	if err := r.db.QueryRowContext(ctx, query, hash).Scan(&family); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTokenNotFound
+		}
+		return err
+	}
+
+	return revokeFamily(ctx, r.db, family)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func revokeFamily(ctx context.Context, db execer, family string) error {
+	stmt := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family = $1 AND revoked_at IS NULL`
+
+	_, err := db.ExecContext(ctx, stmt, family)
+	return err
+}
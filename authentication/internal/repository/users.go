@@ -3,13 +3,18 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/ziliscite/go-micro-authentication/internal/data"
+	"github.com/ziliscite/go-micro-authentication/internal/event"
 	"log/slog"
 	"time"
 )
 
 const DBTimeout = time.Second * 3
 
+// ErrEditConflict means the user changed since it was read, the update didn't happen.
+var ErrEditConflict = errors.New("user was changed by someone else, try again")
+
 // New is the function used to create an instance of the repository package. It returns the type
 // Repository, which embeds all the types we want to be available to our application.
 func New(dbPool *sql.DB) Repository {
@@ -96,6 +101,10 @@ func (r Repository) GetByEmail(ctx context.Context, email string) (*data.User, e
 
 // GetOne returns one user by id
 func (r Repository) GetOne(ctx context.Context, id int) (*data.User, error) {
+	return getUser(ctx, r.db, id)
+}
+
+func getUser(ctx context.Context, db rowQuerier, id int) (*data.User, error) {
 	query := `
 		SELECT id, email, first_name, last_name, password, user_active, created_at, updated_at 
 		FROM users WHERE id = $1
@@ -104,7 +113,7 @@ func (r Repository) GetOne(ctx context.Context, id int) (*data.User, error) {
 	var hashed []byte
 
 	var user data.User
-	if err := r.db.QueryRowContext(ctx, query, id).Scan(
+	if err := db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
 		&user.FirstName,
@@ -169,35 +178,82 @@ func (r Repository) DeleteByID(ctx context.Context, id int) error {
 	return nil
 }
 
-// Insert inserts a new user into the database, and returns the ID of the newly inserted row
-func (r Repository) Insert(ctx context.Context, user *data.User) error {
+// Insert inserts a new user into the database, along with the user.registered event announcing
+// it, in one transaction. The user gets the ID and timestamps of the newly inserted row.
+func (r Repository) Insert(ctx context.Context, user *data.User, correlationID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	stmt := `
 		INSERT INTO users (email, first_name, last_name, password)
-		VALUES ($1, $2, $3, $4) RETURNING id
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
 	`
 
-	var newID int
-	if err := r.db.QueryRowContext(ctx, stmt,
+	if err = tx.QueryRowContext(ctx, stmt,
 		user.Email,
 		user.FirstName,
 		user.LastName,
 		user.Hashed(),
-	).Scan(&newID); err != nil {
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return err
+	}
+
+	e, err := event.NewEnvelope(data.UserRegisteredEvent, eventSource, correlationID, data.UserRegistered{
+		ID:           user.ID,
+		Email:        user.Email,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		RegisteredAt: user.CreatedAt,
+	})
+	if err != nil {
 		return err
 	}
 
-	user.ID = newID
+	if err = insertOutbox(ctx, tx, e); err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit()
 }
 
-// ResetPassword is the method we will use to change a user's password.
-func (r Repository) ResetPassword(ctx context.Context, user *data.User) error {
-	stmt := `UPDATE users SET password = $1 WHERE id = $2 AND updated_at = $3`
-	_, err := r.db.ExecContext(ctx, stmt, user.Hashed(), user.ID, user.UpdatedAt)
+// ResetPassword is the method we will use to change a user's password. The auth.password.reset
+// event is written in the same transaction. If the user changed since it was read, nothing is
+// written and ErrEditConflict is returned.
+func (r Repository) ResetPassword(ctx context.Context, user *data.User, correlationID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	stmt := `UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2 AND updated_at = $3`
+	res, err := tx.ExecContext(ctx, stmt, user.Hashed(), user.ID, user.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrEditConflict
+	}
+
+	e, err := event.NewEnvelope(data.PasswordResetEvent, eventSource, correlationID, data.PasswordReset{
+		UserID: user.ID,
+		Email:  user.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = insertOutbox(ctx, tx, e); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,171 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ziliscite/go-micro-authentication/internal/data"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrInvalidKey   = errors.New("invalid signing key")
+)
+
+// Claims is what we put inside every access token. Subject holds the user ID,
+// so downstream services know who the caller is without asking us.
+type Claims struct {
+	Email  string `json:"email"`
+	Active bool   `json:"active"`
+	jwt.RegisteredClaims
+}
+
+// UserID parses the subject back into the numeric user ID.
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// Issuer signs and verifies access tokens with a single RSA key.
+//
+// The public half is exposed as a JWKS document, so the broker (or anyone else)
+// can verify tokens locally instead of calling back into authentication.
+type Issuer struct {
+	key    *rsa.PrivateKey
+	kid    string
+	issuer string
+	ttl    time.Duration
+}
+
+func NewIssuer(key *rsa.PrivateKey, issuer string, ttl time.Duration) *Issuer {
+	return &Issuer{
+		key:    key,
+		kid:    keyID(&key.PublicKey),
+		issuer: issuer,
+		ttl:    ttl,
+	}
+}
+
+// ParsePrivateKey reads a PEM encoded RSA private key, either PKCS#1 or PKCS#8.
+func ParsePrivateKey(p []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(p)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidKey)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an RSA key", ErrInvalidKey)
+	}
+
+	return rsaKey, nil
+}
+
+// GenerateKey creates a throwaway signing key. Tokens signed with it won't survive a restart,
+// which is fine for local development but not much else.
+func GenerateKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// Issue creates a signed access token for the user, returning the token and when it expires.
+func (i *Issuer) Issue(user *data.User) (string, time.Time, error) {
+	now := time.Now()
+	expiry := now.Add(i.ttl)
+
+	claims := Claims{
+		Email:  user.Email,
+		Active: user.Active,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.issuer,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiry),
+		},
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = i.kid
+
+	signed, err := t.SignedString(i.key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiry, nil
+}
+
+// Verify checks the signature, issuer and expiry of a token and returns its claims.
+func (i *Issuer) Verify(tokenString string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (any, error) {
+		if kid, ok := t.Header["kid"].(string); ok && kid != i.kid {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return &i.key.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(i.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return &claims, nil
+}
+
+// JWK is a single public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is the document served on the well-known endpoint.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public key set used to verify tokens issued by i.
+func (i *Issuer) JWKS() JWKS {
+	pub := i.key.PublicKey
+
+	return JWKS{
+		Keys: []JWK{{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: jwt.SigningMethodRS256.Alg(),
+			Kid: i.kid,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	}
+}
+
+// keyID derives a stable key id from the public key, so it only changes when the key does.
+func keyID(pub *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(pub))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
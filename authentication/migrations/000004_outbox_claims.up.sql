@@ -0,0 +1,8 @@
+-- a relay claims its batch for a while instead of holding row locks while it publishes
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP(0) WITH TIME ZONE;
+
+-- events no queue was bound for are parked, clear it to send them again
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS unroutable_at TIMESTAMP(0) WITH TIME ZONE;
+
+DROP INDEX IF EXISTS outbox_pending_idx;
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL AND unroutable_at IS NULL;
@@ -0,0 +1,202 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Settings tune when a breaker trips and how it recovers.
+type Settings struct {
+	// FailureThreshold is how many failures in a row trip the breaker open
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting a probe through
+	OpenTimeout time.Duration
+	// HalfOpenMax is how many probes may be in flight while half-open
+	HalfOpenMax int
+}
+
+var DefaultSettings = Settings{
+	FailureThreshold: 5,
+	OpenTimeout:      10 * time.Second,
+	HalfOpenMax:      1,
+}
+
+// Breaker stops calls to a dependency that keeps failing, so we fail fast instead of
+// hammering it once per inbound request while it's down.
+//
+// Closed lets everything through and counts consecutive failures. Open rejects everything
+// until OpenTimeout passes. HalfOpen lets a few probes through, one success closes the
+// breaker again and one failure opens it.
+type Breaker struct {
+	name     string
+	settings Settings
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	probes    int
+	openedAt  time.Time
+	lastError string
+
+	// generation changes with the state, the outcome of a call let through in an earlier one
+	// says nothing about the dependency now and is ignored
+	generation uint64
+}
+
+func New(name string, settings Settings) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = DefaultSettings.FailureThreshold
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = DefaultSettings.OpenTimeout
+	}
+	if settings.HalfOpenMax <= 0 {
+		settings.HalfOpenMax = DefaultSettings.HalfOpenMax
+	}
+
+	return &Breaker{
+		name:     name,
+		settings: settings,
+	}
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Allow asks whether a call may go ahead. If it may, the returned function must be called
+// with the outcome once the call is done, nil meaning it went fine.
+func (b *Breaker) Allow() (func(err error), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.settings.OpenTimeout {
+			return nil, ErrOpen
+		}
+		b.setState(HalfOpen)
+		b.probes = 0
+		fallthrough
+	case HalfOpen:
+		if b.probes >= b.settings.HalfOpenMax {
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.record(generation, err) })
+	}, nil
+}
+
+// Execute runs fn if the breaker allows it, and records any error it returns as a failure.
+func (b *Breaker) Execute(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	done(err)
+
+	return err
+}
+
+func (b *Breaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	if b.state == HalfOpen {
+		b.probes--
+	}
+
+	if err == nil {
+		b.setState(Closed)
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+
+	if b.state == HalfOpen || b.failures >= b.settings.FailureThreshold {
+		b.setState(Open)
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state != state {
+		b.state = state
+		b.generation++
+	}
+}
+
+// Snapshot is a point in time view of a breaker, for the status endpoint.
+type Snapshot struct {
+	Name      string     `json:"name"`
+	State     State      `json:"state"`
+	Failures  int        `json:"consecutive_failures"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := Snapshot{
+		Name:      b.name,
+		State:     b.state,
+		Failures:  b.failures,
+		LastError: b.lastError,
+	}
+
+	// an open breaker past its timeout will let the next call through
+	if b.state == Open && time.Since(b.openedAt) >= b.settings.OpenTimeout {
+		s.State = HalfOpen
+	}
+
+	if b.state != Closed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+
+	return s
+}
@@ -0,0 +1,157 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errCall = errors.New("call failed")
+
+// expire makes an open breaker's timeout run out, without waiting for it.
+func expire(b *Breaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.openedAt = time.Now().Add(-b.settings.OpenTimeout)
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	// each step is a call failing or succeeding, or "expire" to run out the open timeout
+	tests := []struct {
+		name  string
+		steps []string
+		want  State
+	}{
+		{"starts closed", nil, Closed},
+		{"failures below the threshold", []string{"fail", "fail"}, Closed},
+		{"success resets the failures", []string{"fail", "fail", "ok", "fail", "fail"}, Closed},
+		{"threshold opens", []string{"fail", "fail", "fail"}, Open},
+		{"half-open after the timeout", []string{"fail", "fail", "fail", "expire"}, HalfOpen},
+		{"probe success closes", []string{"fail", "fail", "fail", "expire", "ok"}, Closed},
+		{"probe failure opens", []string{"fail", "fail", "fail", "expire", "fail"}, Open},
+		{"closed again counts from zero", []string{"fail", "fail", "fail", "expire", "ok", "fail"}, Closed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New("test", Settings{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenMax: 1})
+
+			for _, step := range tt.steps {
+				if step == "expire" {
+					expire(b)
+					continue
+				}
+
+				done, err := b.Allow()
+				if err != nil {
+					t.Fatalf("Allow() before %s: %v", step, err)
+				}
+
+				if step == "fail" {
+					done(errCall)
+				} else {
+					done(nil)
+				}
+			}
+
+			if got := b.Snapshot().State; got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerRejectsWhileOpen(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+	done, _ := b.Allow()
+	done(errCall)
+
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() = %v, want ErrOpen", err)
+	}
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	tests := []struct {
+		name        string
+		halfOpenMax int
+	}{
+		{"one probe", 1},
+		{"several probes", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New("test", Settings{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenMax: tt.halfOpenMax})
+
+			done, _ := b.Allow()
+			done(errCall)
+			expire(b)
+
+			probes := make([]func(error), 0, tt.halfOpenMax)
+			for range tt.halfOpenMax {
+				done, err := b.Allow()
+				if err != nil {
+					t.Fatalf("Allow() for probe %d: %v", len(probes)+1, err)
+				}
+				probes = append(probes, done)
+			}
+
+			if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+				t.Fatalf("Allow() past %d probes = %v, want ErrOpen", tt.halfOpenMax, err)
+			}
+
+			// one success is enough, the probes still in flight don't hold it back
+			probes[0](nil)
+			if got := b.Snapshot().State; got != Closed {
+				t.Fatalf("state after a successful probe = %s, want %s", got, Closed)
+			}
+			if _, err := b.Allow(); err != nil {
+				t.Errorf("Allow() once closed: %v", err)
+			}
+		})
+	}
+}
+
+func TestBreakerIgnoresStaleOutcomes(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenMax: 1})
+
+	// let through while closed, finishes only once the breaker is half-open
+	late, _ := b.Allow()
+
+	done, _ := b.Allow()
+	done(errCall)
+	expire(b)
+
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() for the probe: %v", err)
+	}
+
+	late(nil)
+	if got := b.Snapshot().State; got != HalfOpen {
+		t.Fatalf("state after a stale success = %s, want %s", got, HalfOpen)
+	}
+	if _, err = b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("a stale outcome freed a probe slot, Allow() = %v", err)
+	}
+
+	probe(errCall)
+	if got := b.Snapshot().State; got != Open {
+		t.Errorf("state after the probe failed = %s, want %s", got, Open)
+	}
+}
+
+func TestBreakerRecordsOnce(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 2, OpenTimeout: time.Minute})
+
+	done, _ := b.Allow()
+	done(errCall)
+	done(errCall)
+
+	if got := b.Snapshot(); got.State != Closed || got.Failures != 1 {
+		t.Errorf("state = %s with %d failures, want %s with 1", got.State, got.Failures, Closed)
+	}
+}
@@ -0,0 +1,131 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Budget caps retries to a fraction of regular calls, so a struggling dependency gets at most
+// that much extra load from us instead of a retry storm.
+//
+// Every first attempt deposits ratio tokens, every retry withdraws a whole one.
+type Budget struct {
+	mu     sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+func NewBudget(ratio float64, max int) *Budget {
+	return &Budget{
+		ratio:  ratio,
+		max:    float64(max),
+		tokens: float64(max),
+	}
+}
+
+func (b *Budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.max, b.tokens+b.ratio)
+}
+
+func (b *Budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// Remaining is how many retries the budget would allow right now.
+func (b *Budget) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return int(b.tokens)
+}
+
+// permanentError is never retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retry runs idempotent calls again on failure, backing off with full jitter between attempts.
+// Only use it for calls that are safe to repeat.
+type Retry struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Budget    *Budget
+}
+
+// Do calls fn until it succeeds, returns a permanent error, the breaker is open,
+// the attempts or the budget run out, or ctx is done.
+func (r Retry) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.Budget != nil {
+		r.Budget.deposit()
+	}
+
+	var err error
+	for attempt := 0; attempt < max(r.Attempts, 1); attempt++ {
+		if attempt > 0 {
+			if r.Budget != nil && !r.Budget.withdraw() {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(r.backoff(attempt)):
+			}
+		}
+
+		err = fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+
+		if errors.Is(err, ErrOpen) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (r Retry) backoff(attempt int) time.Duration {
+	ceiling := r.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > r.MaxDelay {
+		ceiling = r.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return rand.N(ceiling)
+}
@@ -0,0 +1,76 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		ratio  float64
+		max    int
+		calls  int   // how many Do calls run one after the other, all failing
+		want   []int // attempts each of them made
+		remain int
+	}{
+		{"budget covers the retries", 1, 10, 1, []int{4}, 7},
+		{"exhausted budget stops retrying", 0.5, 2, 3, []int{3, 1, 2}, 0},
+		{"empty budget never retries", 0, 0, 2, []int{1, 1}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := NewBudget(tt.ratio, tt.max)
+			r := Retry{Attempts: 4, Budget: budget}
+
+			for i := range tt.calls {
+				attempts := 0
+				err := r.Do(context.Background(), func(context.Context) error {
+					attempts++
+					return errCall
+				})
+
+				if !errors.Is(err, errCall) {
+					t.Errorf("call %d: Do() = %v, want %v", i+1, err, errCall)
+				}
+				if attempts != tt.want[i] {
+					t.Errorf("call %d: %d attempts, want %d", i+1, attempts, tt.want[i])
+				}
+			}
+
+			if got := budget.Remaining(); got != tt.remain {
+				t.Errorf("Remaining() = %d, want %d", got, tt.remain)
+			}
+		})
+	}
+}
+
+func TestRetryStops(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"permanent error", Permanent(errCall), errCall},
+		{"open breaker", ErrOpen, ErrOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := Retry{Attempts: 4}.Do(context.Background(), func(context.Context) error {
+				attempts++
+				return tt.err
+			})
+
+			if err != tt.want {
+				t.Errorf("Do() = %v, want %v", err, tt.want)
+			}
+			if attempts != 1 {
+				t.Errorf("%d attempts, want 1", attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// actionSpec is what an action declares about itself when it's registered.
+type actionSpec struct {
+	Name      string // value of "action" in the request body
+	Key       string // key in the request body holding the payload, e.g. "log"
+	Transport string // how the broker reaches the service behind it
+	Public    bool   // callable without an access token
+}
+
+// action is a registered action, with its payload decoding baked in.
+type action struct {
+	actionSpec
+	schema map[string]string
+	decode func(raw json.RawMessage) (any, error)
+	handle func(w http.ResponseWriter, r *http.Request, payload any)
+}
+
+// validator can be implemented by payloads that need more than a successful decode.
+type validator interface {
+	validate() error
+}
+
+// registry holds every action the gateway can dispatch. Adding a new one means
+// declaring its payload type and calling register, the gateway itself never changes.
+type registry struct {
+	mu      sync.RWMutex
+	actions map[string]*action
+}
+
+func newRegistry() *registry {
+	return &registry{
+		actions: make(map[string]*action),
+	}
+}
+
+// register adds an action whose payload decodes into T. Registering the same name twice panics,
+// it's a programming error that should blow up at startup.
+func register[T any](reg *registry, spec actionSpec, handle func(http.ResponseWriter, *http.Request, T)) {
+	if spec.Key == "" {
+		spec.Key = spec.Name
+	}
+
+	a := &action{
+		actionSpec: spec,
+		schema:     schemaOf(reflect.TypeFor[T]()),
+		decode: func(raw json.RawMessage) (any, error) {
+			var payload T
+
+			if err := decodePayload(raw, &payload); err != nil {
+				return nil, err
+			}
+
+			if v, ok := any(&payload).(validator); ok {
+				if err := v.validate(); err != nil {
+					return nil, &validationError{err: err}
+				}
+			}
+
+			return payload, nil
+		},
+		handle: func(w http.ResponseWriter, r *http.Request, payload any) {
+			handle(w, r, payload.(T))
+		},
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, exists := reg.actions[spec.Name]; exists {
+		panic(fmt.Sprintf("action %q registered twice", spec.Name))
+	}
+
+	reg.actions[spec.Name] = a
+}
+
+func (reg *registry) get(name string) (*action, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	a, ok := reg.actions[name]
+	return a, ok
+}
+
+// describe lists the registered actions, sorted by name, for the /actions endpoint.
+func (reg *registry) describe() []map[string]any {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	out := make([]map[string]any, 0, len(reg.actions))
+	for _, a := range reg.actions {
+		out = append(out, map[string]any{
+			"action":    a.Name,
+			"key":       a.Key,
+			"transport": a.Transport,
+			"public":    a.Public,
+			"schema":    a.schema,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i]["action"].(string) < out[j]["action"].(string)
+	})
+
+	return out
+}
+
+var errMissingPayload = errors.New("payload must not be empty")
+
+// validationError means the payload decoded fine but its content was rejected.
+type validationError struct {
+	err error
+}
+
+func (e *validationError) Error() string { return e.err.Error() }
+func (e *validationError) Unwrap() error { return e.err }
+
+func decodePayload(raw json.RawMessage, dst any) error {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return errMissingPayload
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		if strings.HasPrefix(err.Error(), "json: unknown field ") {
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("payload contains unknown key: '%s'", strings.Trim(fieldName, "\""))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// schemaOf maps the json field names of a payload struct to their kinds, good enough
+// for a client to know what to send.
+func schemaOf(t reflect.Type) map[string]string {
+	schema := make(map[string]string)
+	if t.Kind() != reflect.Struct {
+		return schema
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		kind := f.Type.Kind().String()
+		if !strings.Contains(opts, "omitempty") {
+			kind += " (required)"
+		}
+
+		schema[name] = kind
+	}
+
+	return schema
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/ziliscite/go-micro-broker/discovery"
+	logs "github.com/ziliscite/go-micro-broker/proto/genproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// callTimeout bounds every call the broker makes to a downstream service
+	callTimeout = 5 * time.Second
+	dialTimeout = 3 * time.Second
+)
+
+// clients are the long-lived connections the broker keeps to downstream services,
+// created once at startup and shared by every request.
+type clients struct {
+	http *http.Client
+	rpc  *rpcClient
+	grpc *grpc.ClientConn
+	logs logs.LogServiceClient
+}
+
+func newClients(r discovery.Resolver) (*clients, error) {
+	httpClient := &http.Client{
+		Timeout: callTimeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   dialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   20,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: callTimeout,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+
+	// NewClient doesn't connect until the first call, and reconnects with backoff on its own.
+	// The discovery resolver keeps the connection pointed at wherever logger-grpc lives
+	conn, err := grpc.NewClient(discovery.Scheme+":///logger-grpc",
+		grpc.WithResolvers(discovery.GRPCResolver(r, 30*time.Second)),
+		// need credentials, but since we using docker...
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             5 * time.Second,
+			PermitWithoutStream: true,
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: dialTimeout,
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clients{
+		http: httpClient,
+		rpc:  newRPCClient(r, "logger-rpc"),
+		grpc: conn,
+		logs: logs.NewLogServiceClient(conn),
+	}, nil
+}
+
+func (c *clients) Close() error {
+	c.http.CloseIdleConnections()
+	return errors.Join(c.rpc.Close(), c.grpc.Close())
+}
+
+// rpcClient keeps a single net/rpc connection open, which is safe for concurrent calls.
+//
+// The connection is dialed on first use, and thrown away as soon as a call shows it is broken,
+// so the next call resolves the service again and dials a fresh one.
+type rpcClient struct {
+	resolver discovery.Resolver
+	service  string
+
+	mu     sync.Mutex
+	client *rpc.Client
+}
+
+func newRPCClient(r discovery.Resolver, service string) *rpcClient {
+	return &rpcClient{
+		resolver: r,
+		service:  service,
+	}
+}
+
+// Call invokes method on the server, giving up when ctx is done.
+func (c *rpcClient) Call(ctx context.Context, method string, args, reply any) error {
+	client, err := c.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+
+	select {
+	case <-ctx.Done():
+		// the connection may be stuck, don't hand it to anyone else
+		c.discard(client)
+		return ctx.Err()
+	case <-call.Done:
+	}
+
+	if call.Error != nil {
+		// errors returned by the service itself come back as rpc.ServerError,
+		// the connection is still good in that case
+		var serverErr rpc.ServerError
+		if !errors.As(call.Error, &serverErr) {
+			c.discard(client)
+		}
+		return call.Error
+	}
+
+	return nil
+}
+
+func (c *rpcClient) get(ctx context.Context) (*rpc.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	addr, err := c.resolver.Resolve(ctx, c.service)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.client = rpc.NewClient(conn)
+	return c.client, nil
+}
+
+func (c *rpcClient) discard(client *rpc.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == client {
+		_ = c.client.Close()
+		c.client = nil
+	}
+}
+
+func (c *rpcClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return nil
+	}
+
+	err := c.client.Close()
+	c.client = nil
+	return err
+}
@@ -5,15 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"time"
+	"fmt"
+	"strings"
 
-	"github.com/ziliscite/go-micro-broker/event"
-	logs "github.com/ziliscite/go-micro-broker/proto/genproto"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ziliscite/go-micro-broker/discovery"
+	"github.com/ziliscite/go-micro-broker/identity"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"net/http"
-	"net/rpc"
 )
 
 func (app *application) broker(w http.ResponseWriter, r *http.Request) {
@@ -29,203 +28,222 @@ func (app *application) broker(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-type request struct {
-	Action string `json:"action"`
-	Auth   auth   `json:"auth,omitempty"`
-	Log    log    `json:"log,omitempty"`
-	Mail   mail   `json:"mail,omitempty"`
-}
-
 type auth struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+func (a auth) validate() error {
+	if a.Email == "" || a.Password == "" {
+		return errors.New("email and password must be provided")
+	}
+	return nil
+}
+
 type log struct {
 	Title   string `json:"title"`
 	Content string `json:"content"`
-}
 
-type mail struct {
-	From    string `json:"from,omitempty"`
-	To      string `json:"to,omitempty"`
-	Subject string `json:"subject,omitempty"`
-	Message string `json:"message,omitempty"`
-}
+	// Severity is one of DEBUG, INFO (the default), WARN or ERROR, it becomes the routing key over amqp
+	Severity string `json:"severity,omitempty"`
 
-func (app *application) gateway(w http.ResponseWriter, r *http.Request) {
-	var req request
+	// Service is who the entry is from, TraceID the trace it belongs to
+	Service string `json:"service,omitempty"`
+	TraceID string `json:"trace_id,omitempty"`
+	// CorrelationID defaults to the ID of the request carrying the entry
+	CorrelationID string `json:"correlation_id,omitempty"`
 
-	err := app.readBody(w, r, &req)
-	if err != nil {
-		app.error(w, http.StatusBadRequest, err)
-		return
-	}
+	Tags       []string       `json:"tags,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
 
-	// Match the request action
-	switch req.Action {
-	case "authenticate":
-		app.authenticate(w, req.Auth)
-	case "log":
-		//app.log(w, req.Log) -- http
-		//app.pushLog(w, req.Log) -- message broker
-		app.logRPC(w, req.Log)
-
-	case "mail":
-		app.sendMail(w, req.Mail)
-	default:
-		app.error(w, http.StatusNotImplemented, errors.New("unknown action"))
-	}
+	// Transport is an optional hint, it's tried first before the configured order
+	Transport string `json:"transport,omitempty"`
+
+	// eventID is the same on every transport writeLog tries, the logger writes an entry
+	// at most once per event
+	eventID string
 }
 
-func (app *application) authenticate(w http.ResponseWriter, a auth) {
-	// Create the payload
-	payload, err := json.Marshal(a)
-	if err != nil {
-		app.error(w, http.StatusInternalServerError, err)
-		return
+// severity is the normalized severity, INFO when none was given.
+func (l log) severity() string {
+	if l.Severity == "" {
+		return "INFO"
 	}
+	return strings.ToUpper(l.Severity)
+}
 
-	// Call the authentication microservice
-	req, err := http.NewRequest(http.MethodPost, "http://authentication/v1/authenticate", bytes.NewBuffer(payload))
-	// url is composed of [hostname]:[port]/[service name in the docker image]/[method]
-	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
-		return
+// correlationID is the one given with the entry, or the ID of the request carrying it.
+func (l log) correlationID(ctx context.Context) string {
+	if l.CorrelationID != "" {
+		return l.CorrelationID
 	}
+	return middleware.GetReqID(ctx)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
-		return
+// logEntry is a log the way the logger takes it over http, and the listener reads it off the queue.
+type logEntry struct {
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Severity string `json:"severity"`
+
+	Service       string         `json:"service,omitempty"`
+	TraceID       string         `json:"trace_id,omitempty"`
+	CorrelationID string         `json:"correlation_id,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	EventID       string         `json:"event_id,omitempty"`
+}
+
+func (l log) entry(ctx context.Context) logEntry {
+	return logEntry{
+		Title:         l.Title,
+		Content:       l.Content,
+		Severity:      l.severity(),
+		Service:       l.Service,
+		TraceID:       l.TraceID,
+		CorrelationID: l.correlationID(ctx),
+		Tags:          l.Tags,
+		Attributes:    l.Attributes,
+		EventID:       l.eventID,
 	}
-	defer resp.Body.Close()
+}
 
-	var message string
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		message = "invalid credentials"
+func (l log) validate() error {
+	if l.Title == "" {
+		return errors.New("title must be provided")
+	}
+	switch strings.ToUpper(l.Severity) {
+	case "", "DEBUG", "INFO", "WARN", "ERROR":
 	default:
-		message = "auth service could not process your request"
+		return fmt.Errorf("unknown severity %q", l.Severity)
 	}
-
-	// Check the status code
-	if resp.StatusCode != http.StatusAccepted {
-		app.error(w, resp.StatusCode, errors.New(message))
-		return
+	if l.Transport != "" && !validTransport(l.Transport) {
+		return fmt.Errorf("unknown transport %q", l.Transport)
 	}
+	return nil
+}
 
-	// Decode the response
-	var jsonResp response
-	if err = json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
-		return
-	}
+// mail fields without omitempty are listed as required by /actions, keep them in line with validate.
+type mail struct {
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Message string `json:"message,omitempty"`
+}
 
-	if jsonResp.Error {
-		app.error(w, http.StatusUnauthorized, errors.New(jsonResp.Message))
-		return
-	}
+// mailRequest is the payload of mail.send events.
+type mailRequest struct {
+	mail
+	RequestedBy string `json:"requested_by,omitempty"`
+}
 
-	// Add the auth token to the response
-	if err = app.write(w, http.StatusOK, jsonResp); err != nil {
-		app.error(w, http.StatusInternalServerError, err)
-		return
+func (m mail) validate() error {
+	if m.To == "" {
+		return errors.New("recipient must be provided")
 	}
+	return nil
 }
 
-func (app *application) log(w http.ResponseWriter, l log) {
-	// Create the payload
-	payload, err := json.Marshal(l)
+// registerActions declares every action the gateway can dispatch.
+//
+// To add one, define its payload type and a handler with the same shape as the ones below.
+func (app *application) registerActions() {
+	register(app.actions, actionSpec{Name: "authenticate", Key: "auth", Transport: "http", Public: true}, app.authenticate)
+	register(app.actions, actionSpec{Name: "log", Key: "log", Transport: strings.Join(app.logTransports, ",")}, app.writeLog)
+	register(app.actions, actionSpec{Name: "mail", Key: "mail", Transport: "amqp"}, app.sendMail)
+}
+
+func (app *application) gateway(w http.ResponseWriter, r *http.Request) {
+	var body map[string]json.RawMessage
+
+	err := app.readBody(w, r, &body)
 	if err != nil {
-		app.error(w, http.StatusInternalServerError, err)
+		app.error(w, http.StatusBadRequest, err)
 		return
 	}
 
-	// Call the authentication microservice
-	req, err := http.NewRequest(http.MethodPost, "http://logger/v1/logs", bytes.NewBuffer(payload))
-	// url is composed of [hostname]:[port]/[service name in the docker image]/[method]
-	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
+	var name string
+	if err = json.Unmarshal(body["action"], &name); err != nil || name == "" {
+		app.error(w, http.StatusBadRequest, errors.New("body must contain an action"))
 		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
+	// Match the request action
+	act, ok := app.actions.get(name)
+	if !ok {
+		app.error(w, http.StatusNotImplemented, errors.New("unknown action"))
 		return
 	}
-	defer resp.Body.Close()
 
-	var message string
-	switch resp.StatusCode {
-	case http.StatusConflict:
-		message = "a conflict occurred"
-	case http.StatusBadRequest:
-		message = "invalid log data"
-	case http.StatusGatewayTimeout:
-		message = "gateway timeout"
-	case http.StatusNotFound:
-		message = "resource not found"
-	default:
-		message = "log service could not process your request"
+	for key := range body {
+		if key != "action" && key != act.Key {
+			app.error(w, http.StatusBadRequest, fmt.Errorf("body contains unknown key: '%s'", key))
+			return
+		}
 	}
 
-	// Check the status code
-	if resp.StatusCode != http.StatusAccepted {
-		app.error(w, resp.StatusCode, errors.New(message))
+	if !act.Public && !app.authorize(w, r) {
 		return
 	}
 
-	// Decode the response
-	var jsonResp response
-	if err = json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
+	payload, err := act.decode(body[act.Key])
+	if err != nil {
+		var vErr *validationError
+		switch {
+		case errors.As(err, &vErr):
+			app.error(w, http.StatusUnprocessableEntity, fmt.Errorf("%s: %w", act.Key, err))
+		default:
+			app.error(w, http.StatusBadRequest, fmt.Errorf("%s: %w", act.Key, err))
+		}
 		return
 	}
 
-	if jsonResp.Error {
-		app.error(w, http.StatusInternalServerError, errors.New(jsonResp.Message))
-		return
-	}
+	act.handle(w, r, payload)
+}
 
-	if err = app.write(w, http.StatusOK, jsonResp); err != nil {
+// listActions tells clients which actions exist and what payload each one expects.
+func (app *application) listActions(w http.ResponseWriter, r *http.Request) {
+	if err := app.write(w, http.StatusOK, response{
+		Error:   false,
+		Message: "Available actions",
+		Data:    app.actions.describe(),
+	}); err != nil {
 		app.error(w, http.StatusInternalServerError, err)
-		return
 	}
 }
 
-func (app *application) sendMail(w http.ResponseWriter, m mail) {
+func (app *application) authenticate(w http.ResponseWriter, r *http.Request, a auth) {
 	// Create the payload
-	payload, err := json.Marshal(m)
+	payload, err := json.Marshal(a)
 	if err != nil {
 		app.error(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	req, err := http.NewRequest(http.MethodPost, "http://mailer/v1/send", bytes.NewBuffer(payload))
-	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
-		return
-	}
+	ctx, cancel := context.WithTimeout(r.Context(), callTimeout)
+	defer cancel()
 
-	req.Header.Set("Content-Type", "application/json")
+	// Call the authentication microservice, retried only when it couldn't be reached
+	resp, err := app.doHTTP(ctx, app.deps.authentication, &app.deps.authRetry, func(ctx context.Context) (*http.Request, error) {
+		url, err := discovery.URL(ctx, app.resolver, "authentication", "/v1/authenticate")
+		if err != nil {
+			return nil, err
+		}
 
-	resp, err := http.DefaultClient.Do(req)
+		return http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	})
 	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
+		app.unavailable(w, app.deps.authentication, err)
 		return
 	}
 	defer resp.Body.Close()
 
 	var message string
 	switch resp.StatusCode {
-	case http.StatusBadRequest:
-		message = "invalid email data"
+	case http.StatusUnauthorized:
+		message = "invalid credentials"
 	default:
-		message = "mailer could not process your request"
+		message = "auth service could not process your request"
 	}
 
 	// Check the status code
@@ -242,7 +260,7 @@ func (app *application) sendMail(w http.ResponseWriter, m mail) {
 	}
 
 	if jsonResp.Error {
-		app.error(w, http.StatusInternalServerError, errors.New(jsonResp.Message))
+		app.error(w, http.StatusUnauthorized, errors.New(jsonResp.Message))
 		return
 	}
 
@@ -253,87 +271,32 @@ func (app *application) sendMail(w http.ResponseWriter, m mail) {
 	}
 }
 
-func (app *application) pushLog(w http.ResponseWriter, l log) {
-	err := app.pushToQueue(l.Title, l.Content)
-	if err != nil {
-		app.error(w, http.StatusInternalServerError, err)
-		return
+// sendMail queues the email on the mail.send topic, the mailer sends it from its own durable
+// queue and records whether it went through, so the request survives the mailer restarting.
+func (app *application) sendMail(w http.ResponseWriter, r *http.Request, m mail) {
+	req := mailRequest{mail: m}
+	if caller := identity.FromContext(r.Context()); caller != nil {
+		req.RequestedBy = caller.UserID
 	}
 
-	if err = app.write(w, http.StatusAccepted, response{
-		Error:   false,
-		Message: "Log pushed to queue",
-	}); err != nil {
-		app.error(w, http.StatusInternalServerError, err)
-		return
-	}
-}
-
-// same pattern to publish shit to queue
-func (app *application) pushToQueue(name, msg string) error {
-	pub, err := event.NewPublisher(app.rabbit)
-	if err != nil {
-		return err
-	}
-
-	p := log{
-		Title:   name,
-		Content: msg,
-	}
-
-	pj, err := json.Marshal(&p)
-	if err != nil {
-		return err
-	}
-
-	// might wanna break it into some log types
-	return pub.Push(string(pj), "log.INFO")
-}
-
-func (app *application) logRPC(w http.ResponseWriter, l log) {
-	type rpcPayload struct {
-		Name string `json:"name"`
-		Data string `json:"data"`
-	}
-
-	// Get rpc client
-	client, err := rpc.Dial("tcp", "logger:5001") // same name in docker compose
+	// returns once rabbitmq has the email, or fails if the mailer's queue isn't there to take it
+	e, err := app.publish(r.Context(), "mail.send", req)
 	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
-		return
-	}
-	defer client.Close()
-
-	// Create type that exactly matches the on the rpc
-	payload := rpcPayload{
-		Name: l.Title,
-		Data: l.Content,
-	}
-
-	var res string // response from the rpc
-
-	// The service method name must exactly match the one on the rpc
-	//
-	// Must start with a capital letter to be exported (so that it works)
-	err = client.Call("RPCServer.LogInfo", payload, &res)
-	if err != nil {
-		app.error(w, http.StatusInternalServerError, err)
+		app.unavailable(w, app.deps.rabbitmq, err)
 		return
 	}
 
-	if err = app.write(w, http.StatusOK, response{
+	// the event ID is what the mailer records the delivery status under
+	if err = app.write(w, http.StatusAccepted, response{
 		Error:   false,
-		Message: res,
+		Message: fmt.Sprintf("Email to %s is queued", m.To),
+		Data:    map[string]string{"id": e.ID},
 	}); err != nil {
 		app.error(w, http.StatusInternalServerError, err)
-		return
 	}
 }
 
 func (app *application) logGRPC(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
-	defer cancel()
-
 	var l log
 
 	err := app.readBody(w, r, &l)
@@ -342,35 +305,22 @@ func (app *application) logGRPC(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get grpc client
-	// need credentials, but since we using docker...
-	client, err := grpc.NewClient("logger:50001", grpc.WithTransportCredentials(insecure.NewCredentials())) // same name in docker compose
-	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
+	// the same checks the gateway runs on a log action
+	if err = l.validate(); err != nil {
+		app.error(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	defer client.Close()
-
-	// This should (along with the client, which can be treated as database connection)
-	// be injected as a dependency
-	//
-	// On the application / handler struct -- like a repository
-	logClient := logs.NewLogServiceClient(client)
-
-	resp, err := logClient.WriteLog(ctx, &logs.LogRequest{
-		Entry: &logs.Log{
-			Name: l.Title,
-			Data: l.Content,
-		},
-	})
+
+	message, err := app.logViaGRPC(r.Context(), l)
 	if err != nil {
-		app.error(w, http.StatusServiceUnavailable, err)
+		app.logTransportError(w, err)
 		return
 	}
 
 	if err = app.write(w, http.StatusOK, response{
 		Error:   false,
-		Message: resp.Response,
+		Message: message,
+		Data:    logResult{Transport: transportGRPC},
 	}); err != nil {
 		app.error(w, http.StatusInternalServerError, err)
 		return
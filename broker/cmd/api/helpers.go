@@ -55,6 +55,18 @@ func (app *application) error(w http.ResponseWriter, code int, e error) {
 	}
 }
 
+func (app *application) invalidToken(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication token"
+	app.error(w, http.StatusUnauthorized, errors.New(message))
+}
+
+func (app *application) authenticationRequired(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "you must be authenticated to access this resource"
+	app.error(w, http.StatusUnauthorized, errors.New(message))
+}
+
 func (app *application) readBody(w http.ResponseWriter, r *http.Request, dst any) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ziliscite/go-micro-broker/identity"
+	"google.golang.org/grpc/metadata"
+)
+
+// Headers (and gRPC metadata keys) the broker uses to tell downstream services who the caller is.
+//
+// Downstream services sit behind the broker on the internal network, so they can trust these.
+const (
+	headerUserID    = "X-User-ID"
+	headerUserEmail = "X-User-Email"
+)
+
+// tokenFailureKey holds why the bearer token of a request didn't verify.
+type tokenFailureKey struct{}
+
+// identify reads the bearer token from the Authorization header, if there is one, and puts the
+// verified identity in the request context. Requests without a token pass through anonymously,
+// it's up to the handler (or requireIdentity) to decide whether that's good enough.
+//
+// A token that doesn't verify doesn't stop the request either, it goes on anonymously with the
+// failure recorded. A client holding an expired token can still call the public actions, like
+// authenticate to get a new one. Everything else reports the failure through authorize.
+func (app *application) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenFailureKey{}, identity.ErrInvalidToken)))
+			return
+		}
+
+		id, err := app.verifier.Verify(r.Context(), token)
+		if err != nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenFailureKey{}, err)))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), id)))
+	})
+}
+
+// requireIdentity rejects requests authorize doesn't let through, must be used after identify.
+func (app *application) requireIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.authorize(w, r) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize tells whether the request comes from an active user, answering it otherwise: a token
+// that didn't verify gets a 401, keys that couldn't be fetched a 503, an inactive user a 403.
+func (app *application) authorize(w http.ResponseWriter, r *http.Request) bool {
+	id := identity.FromContext(r.Context())
+	if id != nil {
+		if !id.Active {
+			app.error(w, http.StatusForbidden, errors.New("your user account must be activated to access this resource"))
+			return false
+		}
+		return true
+	}
+
+	failure, _ := r.Context().Value(tokenFailureKey{}).(error)
+	switch {
+	case failure == nil:
+		app.authenticationRequired(w)
+	case errors.Is(failure, identity.ErrInvalidToken), errors.Is(failure, identity.ErrUnknownKey):
+		app.invalidToken(w)
+	default:
+		// couldn't reach authentication for the keys
+		app.error(w, http.StatusServiceUnavailable, failure)
+	}
+
+	return false
+}
+
+// forwardIdentity copies the caller's identity onto an outgoing HTTP request.
+func forwardIdentity(ctx context.Context, req *http.Request) {
+	id := identity.FromContext(ctx)
+	if id == nil {
+		return
+	}
+
+	req.Header.Set(headerUserID, id.UserID)
+	req.Header.Set(headerUserEmail, id.Email)
+}
+
+// outgoingIdentity returns a context carrying the caller's identity as gRPC metadata.
+func outgoingIdentity(ctx context.Context) context.Context {
+	id := identity.FromContext(ctx)
+	if id == nil {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx,
+		strings.ToLower(headerUserID), id.UserID,
+		strings.ToLower(headerUserEmail), id.Email,
+	)
+}
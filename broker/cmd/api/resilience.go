@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/rpc"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ziliscite/go-micro-broker/breaker"
+	"github.com/ziliscite/go-micro-broker/event"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// dependencies holds one circuit breaker per downstream service the broker talks to.
+type dependencies struct {
+	authentication *breaker.Breaker
+	logger         *breaker.Breaker
+	rabbitmq       *breaker.Breaker
+
+	// retry policy for calls to authentication. Logging in writes a refresh token and an audit
+	// event, so doHTTP only uses it for requests that never reached the service
+	authRetry breaker.Retry
+}
+
+func newDependencies() *dependencies {
+	return &dependencies{
+		authentication: breaker.New("authentication", breaker.DefaultSettings),
+		logger:         breaker.New("logger", breaker.DefaultSettings),
+		rabbitmq:       breaker.New("rabbitmq", breaker.DefaultSettings),
+		authRetry: breaker.Retry{
+			Attempts:  3,
+			BaseDelay: 100 * time.Millisecond,
+			MaxDelay:  time.Second,
+			Budget:    breaker.NewBudget(0.2, 10),
+		},
+	}
+}
+
+func (d *dependencies) breakers() []*breaker.Breaker {
+	return []*breaker.Breaker{d.authentication, d.logger, d.rabbitmq}
+}
+
+// doHTTP sends a request built by build through the dependency's breaker, retrying with retry
+// if it's not nil. Only a request that couldn't be sent is tried again, one that timed out or got
+// a 5xx may have done its work already, so it's safe for requests that aren't idempotent.
+//
+// 5xx responses count as failures, 4xx ones are the caller's fault and don't.
+func (app *application) doHTTP(ctx context.Context, dep *breaker.Breaker, retry *breaker.Retry, build func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	var resp *http.Response
+
+	attempt := func(ctx context.Context) error {
+		req, err := build(ctx)
+		if err != nil {
+			return breaker.Permanent(err)
+		}
+
+		err = dep.Execute(func() error {
+			res, err := app.clients.http.Do(req)
+			if err != nil {
+				return err
+			}
+
+			if res.StatusCode >= http.StatusInternalServerError {
+				res.Body.Close()
+				return fmt.Errorf("%s responded with status %d", dep.Name(), res.StatusCode)
+			}
+
+			resp = res
+			return nil
+		})
+		if err != nil && !errors.Is(err, breaker.ErrOpen) && !unsent(err) {
+			return breaker.Permanent(err)
+		}
+
+		return err
+	}
+
+	if retry == nil {
+		return resp, attempt(ctx)
+	}
+
+	return resp, retry.Do(ctx, attempt)
+}
+
+// unsent tells whether err happened before the request went out: the service couldn't be
+// resolved or connected to.
+func unsent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// rpcFailure tells whether a net/rpc error means the logger is in trouble. Errors returned by the
+// service itself (rpc.ServerError) mean it's up and answering.
+func rpcFailure(err error) error {
+	var serverErr rpc.ServerError
+	if errors.As(err, &serverErr) {
+		return nil
+	}
+	return err
+}
+
+// grpcFailure tells whether a gRPC error means the logger is in trouble, as opposed to it
+// rejecting the request.
+func grpcFailure(err error) error {
+	switch status.Code(err) {
+	case codes.OK, codes.InvalidArgument, codes.AlreadyExists, codes.NotFound,
+		codes.FailedPrecondition, codes.PermissionDenied, codes.Unauthenticated:
+		return nil
+	default:
+		return err
+	}
+}
+
+// amqpFailure tells whether a publishing error means rabbitmq is in trouble. A message nobody
+// is bound to receive is a routing problem, rabbitmq itself is fine.
+func amqpFailure(err error) error {
+	if errors.Is(err, event.ErrUnroutable) {
+		return nil
+	}
+	return err
+}
+
+// publish wraps payload in an envelope of the given type and publishes it through the rabbitmq
+// breaker, waiting for rabbitmq to confirm it. The envelope is returned for its ID.
+func (app *application) publish(ctx context.Context, typ string, payload any) (event.Envelope, error) {
+	// the request ID ties together everything one request caused
+	e, err := event.NewEnvelope(typ, "broker", middleware.GetReqID(ctx), payload)
+	if err != nil {
+		return e, err
+	}
+
+	return e, app.publishEnvelope(ctx, e)
+}
+
+// publishEnvelope publishes e as it is through the rabbitmq breaker, waiting for the confirm.
+func (app *application) publishEnvelope(ctx context.Context, e event.Envelope) error {
+	done, err := app.deps.rabbitmq.Allow()
+	if err != nil {
+		return err
+	}
+
+	err = app.publisher.Publish(ctx, e)
+	done(amqpFailure(err))
+
+	return err
+}
+
+// unavailable writes a 503, with a clearer message when it's the breaker refusing the call.
+func (app *application) unavailable(w http.ResponseWriter, dep *breaker.Breaker, err error) {
+	if errors.Is(err, breaker.ErrOpen) {
+		app.error(w, http.StatusServiceUnavailable, fmt.Errorf("%s is unavailable, try again later", dep.Name()))
+		return
+	}
+
+	app.error(w, http.StatusServiceUnavailable, err)
+}
+
+// status reports the state of each dependency's circuit breaker.
+func (app *application) status(w http.ResponseWriter, r *http.Request) {
+	breakers := make([]breaker.Snapshot, 0, len(app.deps.breakers()))
+	for _, b := range app.deps.breakers() {
+		breakers = append(breakers, b.Snapshot())
+	}
+
+	if err := app.write(w, http.StatusOK, response{
+		Error:   false,
+		Message: "Broker status",
+		Data: map[string]any{
+			"breakers": breakers,
+			"retry_budget": map[string]int{
+				app.deps.authentication.Name(): app.deps.authRetry.Budget.Remaining(),
+			},
+		},
+	}); err != nil {
+		app.error(w, http.StatusInternalServerError, err)
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -22,12 +26,61 @@ func (app *application) routes() http.Handler {
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		}),
 		middleware.Heartbeat("/ping"),
+		// honours X-Request-Id, and becomes the correlation ID of the events we publish
+		middleware.RequestID,
+		app.identify,
 	)
 
 	mux.Post("/", app.broker)
+	mux.Get("/status", app.status)
+
+	// actions decide for themselves whether they need an identity
 	mux.Post("/handle", app.gateway)
+	mux.Get("/actions", app.listActions)
 
-	mux.Post("/log/grpc", app.logGRPC)
+	mux.With(app.requireIdentity).Post("/log/grpc", app.logGRPC)
+	mux.With(app.requireIdentity).Get("/log/stream", app.streamLogs)
 
 	return middleware.Recoverer(mux)
 }
+
+// serve runs the server until ctx is done, then stops accepting connections and waits for
+// in-flight requests to finish, for at most the shutdown timeout.
+func (app *application) serve(ctx context.Context) error {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", app.cfg.Port),
+		Handler: app.routes(),
+	}
+
+	server.RegisterOnShutdown(func() {
+		close(app.shutdown)
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Starting broker service", "port", app.cfg.Port, "log_transports", app.logTransports)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down broker service", "timeout", app.cfg.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("draining requests: %w", err)
+	}
+
+	// ListenAndServe returns ErrServerClosed right away once Shutdown is called
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	logs "github.com/ziliscite/go-micro-broker/proto/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// streamHeartbeat is how often streamLogs writes to an idle stream, so proxies don't cut it
+const streamHeartbeat = 15 * time.Second
+
+// auditTag marks the entries the listener writes for authentication's events. They carry other
+// users' emails and addresses, only admins see them, straight from the logger.
+const auditTag = "audit"
+
+// streamedEntry is a log entry as streamLogs sends it, shaped like the logger's own entries.
+type streamedEntry struct {
+	ID            string         `json:"id"`
+	EventID       string         `json:"event_id,omitempty"`
+	Title         string         `json:"title"`
+	Content       string         `json:"content"`
+	Severity      string         `json:"severity,omitempty"`
+	Service       string         `json:"service,omitempty"`
+	TraceID       string         `json:"trace_id,omitempty"`
+	CorrelationID string         `json:"correlation_id,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+func newStreamedEntry(e *logs.Entry) streamedEntry {
+	l := e.GetLog()
+
+	entry := streamedEntry{
+		ID:            e.GetId(),
+		EventID:       l.GetEventId(),
+		Title:         l.GetName(),
+		Content:       l.GetData(),
+		Service:       l.GetService(),
+		TraceID:       l.GetTraceId(),
+		CorrelationID: l.GetCorrelationId(),
+		Tags:          l.GetTags(),
+		CreatedAt:     e.GetCreatedAt().AsTime(),
+		UpdatedAt:     e.GetUpdatedAt().AsTime(),
+	}
+
+	if l.GetSeverity() != logs.Severity_SEVERITY_UNSPECIFIED {
+		entry.Severity = strings.TrimPrefix(l.GetSeverity().String(), "SEVERITY_")
+	}
+	if l.GetAttributes() != nil {
+		entry.Attributes = l.GetAttributes().AsMap()
+	}
+
+	return entry
+}
+
+// streamLogs relays the logger's live tail as server-sent "log" events carrying the entry, the
+// audit entries left out. It takes the filters of the logger's GET /v1/logs: from and to (RFC
+// 3339), title, severity (comma separated), service and q. A client too slow to keep up misses
+// entries, a "dropped" event with how many comes before the next one it gets.
+func (app *application) streamLogs(w http.ResponseWriter, r *http.Request) {
+	if app.cfg.LoggerAdminToken == "" {
+		app.error(w, http.StatusServiceUnavailable, errors.New("log streaming is disabled, LOGGER_ADMIN_TOKEN is not set"))
+		return
+	}
+
+	req, err := readTailRequest(r.URL.Query())
+	if err != nil {
+		app.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the stream ends with the client, or when we shut down
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-app.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	done, err := app.deps.logger.Allow()
+	if err != nil {
+		app.unavailable(w, app.deps.logger, err)
+		return
+	}
+
+	stream, err := app.clients.logs.TailLogs(metadata.AppendToOutgoingContext(outgoingIdentity(ctx),
+		"authorization", "Bearer "+app.cfg.LoggerAdminToken,
+	), req)
+	done(grpcFailure(err))
+	if err != nil {
+		app.unavailable(w, app.deps.logger, err)
+		return
+	}
+
+	// Recv blocks, the heartbeat can't wait on it
+	received := make(chan *logs.TailLogsResponse)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				failed <- err
+				return
+			}
+
+			select {
+			case received <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx buffers responses by default, which holds the events back
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err = <-failed:
+			if code := status.Code(err); code != codes.Canceled && code != codes.Unavailable {
+				slog.Warn("Log tail ended", "error", err)
+			}
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case res := <-received:
+			if res.GetDropped() > 0 {
+				if _, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", res.GetDropped()); err != nil {
+					return
+				}
+			}
+
+			if slices.Contains(res.GetEntry().GetLog().GetTags(), auditTag) {
+				continue
+			}
+
+			var b []byte
+			if b, err = json.Marshal(newStreamedEntry(res.GetEntry())); err != nil {
+				// the stream is already going, skip the entry rather than end it
+				slog.Error("Failed to encode streamed entry", "id", res.GetEntry().GetId(), "error", err)
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "id: %s\nevent: log\ndata: %s\n\n", res.GetEntry().GetId(), b)
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readTailRequest reads the filters of a tail from the query string.
+func readTailRequest(qs url.Values) (*logs.TailLogsRequest, error) {
+	req := &logs.TailLogsRequest{
+		Title:   qs.Get("title"),
+		Service: qs.Get("service"),
+		Search:  qs.Get("q"),
+	}
+
+	var from, to time.Time
+	var err error
+	if v := qs.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("from must be an RFC 3339 time: %w", err)
+		}
+		req.From = timestamppb.New(from)
+	}
+	if v := qs.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("to must be an RFC 3339 time: %w", err)
+		}
+		req.To = timestamppb.New(to)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, errors.New("from must be before to")
+	}
+
+	if v := qs.Get("severity"); v != "" {
+		for _, severity := range strings.Split(v, ",") {
+			severity = strings.ToUpper(strings.TrimSpace(severity))
+
+			value, ok := logs.Severity_value["SEVERITY_"+severity]
+			if !ok || value == int32(logs.Severity_SEVERITY_UNSPECIFIED) {
+				return nil, fmt.Errorf("unknown severity %q", severity)
+			}
+			req.Severity = append(req.Severity, logs.Severity(value))
+		}
+	}
+
+	return req, nil
+}
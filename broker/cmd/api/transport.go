@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ziliscite/go-micro-broker/discovery"
+	"github.com/ziliscite/go-micro-broker/event"
+	logs "github.com/ziliscite/go-micro-broker/proto/genproto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The ways the broker can get a log entry to the logger service.
+const (
+	transportHTTP = "http"
+	transportAMQP = "amqp"
+	transportRPC  = "rpc"
+	transportGRPC = "grpc"
+)
+
+// defaultLogTransports is the order used when LOG_TRANSPORTS is not set.
+var defaultLogTransports = []string{transportRPC, transportGRPC, transportHTTP, transportAMQP}
+
+func validTransport(name string) bool {
+	return slices.Contains(defaultLogTransports, name)
+}
+
+// parseLogTransports checks a list of transport names like ["grpc", "amqp"] and turns it into
+// a transport order, dropping duplicates.
+func parseLogTransports(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return defaultLogTransports, nil
+	}
+
+	var order []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validTransport(name) {
+			return nil, fmt.Errorf("unknown log transport %q", name)
+		}
+		if !slices.Contains(order, name) {
+			order = append(order, name)
+		}
+	}
+
+	return order, nil
+}
+
+// rejectedError means the logger got the entry and refused it, so trying another transport
+// won't help. Anything else is treated as the transport being unavailable.
+type rejectedError struct {
+	status int
+	err    error
+}
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+func (e *rejectedError) Unwrap() error { return e.err }
+
+// logAttempt records a transport that failed before one succeeded.
+type logAttempt struct {
+	Transport string `json:"transport"`
+	Error     string `json:"error"`
+}
+
+// logResult reports which transport carried the log.
+type logResult struct {
+	Transport string       `json:"transport"`
+	Fallbacks []logAttempt `json:"fallbacks,omitempty"`
+}
+
+// writeLog is the handler for the "log" action. It tries each transport in order, falling back
+// to the next one on failure, and reports which one finally carried the entry.
+//
+// A transport can fail after the logger got the entry, on a timeout say. Every transport carries
+// the same event ID, so the logger takes the entry the next one brings as already written.
+func (app *application) writeLog(w http.ResponseWriter, r *http.Request, l log) {
+	var err error
+	if l.eventID, err = event.NewID(); err != nil {
+		app.error(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	order := app.logTransports
+	if l.Transport != "" {
+		// the hint goes first, the rest keep their configured order
+		order = append([]string{l.Transport}, slices.DeleteFunc(slices.Clone(order), func(name string) bool {
+			return name == l.Transport
+		})...)
+	}
+
+	var result logResult
+	for _, name := range order {
+		message, err := app.sendLog(r.Context(), name, l)
+		if err == nil {
+			result.Transport = name
+			slog.Info("Log written", "transport", name, "fallbacks", len(result.Fallbacks))
+
+			if err = app.write(w, http.StatusOK, response{
+				Error:   false,
+				Message: message,
+				Data:    result,
+			}); err != nil {
+				app.error(w, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			app.logTransportError(w, err)
+			return
+		}
+
+		slog.Warn("Log transport failed, falling back", "transport", name, "error", err)
+		result.Fallbacks = append(result.Fallbacks, logAttempt{Transport: name, Error: err.Error()})
+	}
+
+	app.error(w, http.StatusServiceUnavailable, errors.New("no log transport could deliver the entry"))
+}
+
+func (app *application) sendLog(ctx context.Context, transport string, l log) (string, error) {
+	switch transport {
+	case transportHTTP:
+		return app.logViaHTTP(ctx, l)
+	case transportAMQP:
+		return app.logViaAMQP(ctx, l)
+	case transportRPC:
+		return app.logViaRPC(ctx, l)
+	case transportGRPC:
+		return app.logViaGRPC(ctx, l)
+	default:
+		return "", fmt.Errorf("unknown log transport %q", transport)
+	}
+}
+
+func (app *application) logTransportError(w http.ResponseWriter, err error) {
+	var rejected *rejectedError
+	if errors.As(err, &rejected) {
+		app.error(w, rejected.status, err)
+		return
+	}
+
+	app.error(w, http.StatusServiceUnavailable, err)
+}
+
+func (app *application) logViaHTTP(ctx context.Context, l log) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	// Create the payload
+	payload, err := json.Marshal(l.entry(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	// Call the logger microservice, creating an entry is not idempotent so no retries
+	resp, err := app.doHTTP(ctx, app.deps.logger, nil, func(ctx context.Context) (*http.Request, error) {
+		url, err := discovery.URL(ctx, app.resolver, "logger", "/v1/logs")
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		forwardIdentity(ctx, req)
+
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK: // 200 when the event was logged already
+	case http.StatusConflict:
+		return "", &rejectedError{status: resp.StatusCode, err: errors.New("a conflict occurred")}
+	case http.StatusBadRequest:
+		return "", &rejectedError{status: resp.StatusCode, err: errors.New("invalid log data")}
+	case http.StatusGatewayTimeout:
+		return "", errors.New("gateway timeout")
+	case http.StatusNotFound:
+		return "", errors.New("resource not found")
+	default:
+		return "", errors.New("log service could not process your request")
+	}
+
+	// Decode the response
+	var jsonResp response
+	if err = json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
+		return "", err
+	}
+
+	if jsonResp.Error {
+		return "", errors.New(jsonResp.Message)
+	}
+
+	return jsonResp.Message, nil
+}
+
+// logViaAMQP returns once rabbitmq confirms it has the entry, a listener picks it up from there.
+func (app *application) logViaAMQP(ctx context.Context, l log) (string, error) {
+	if err := app.pushToQueue(ctx, l); err != nil {
+		return "", err
+	}
+
+	return "Log pushed to queue", nil
+}
+
+// same pattern to publish shit to queue
+func (app *application) pushToQueue(ctx context.Context, l log) error {
+	// the severity travels in the type too, which is the routing key: log.INFO, log.WARN or log.ERROR
+	e, err := event.NewEnvelope("log."+l.severity(), "broker", middleware.GetReqID(ctx), l.entry(ctx))
+	if err != nil {
+		return err
+	}
+
+	// the listener writes the entry under the envelope's ID, it has to be the one the other transports use
+	if l.eventID != "" {
+		e.ID = l.eventID
+	}
+
+	return app.publishEnvelope(ctx, e)
+}
+
+func (app *application) logViaRPC(ctx context.Context, l log) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	// gob matches fields by name, they have to be the same as on the rpc
+	type rpcPayload struct {
+		Name     string `json:"name"`
+		Data     string `json:"data"`
+		Severity string `json:"severity"`
+
+		Service       string `json:"service"`
+		TraceID       string `json:"trace_id"`
+		CorrelationID string `json:"correlation_id"`
+
+		Tags []string `json:"tags"`
+		// Attributes is a json object, gob can't carry arbitrary values
+		Attributes json.RawMessage `json:"attributes"`
+
+		EventID string `json:"event_id"`
+	}
+
+	// Create type that exactly matches the on the rpc
+	payload := rpcPayload{
+		Name:          l.Title,
+		Data:          l.Content,
+		Severity:      l.severity(),
+		Service:       l.Service,
+		TraceID:       l.TraceID,
+		CorrelationID: l.correlationID(ctx),
+		Tags:          l.Tags,
+		EventID:       l.eventID,
+	}
+
+	if len(l.Attributes) > 0 {
+		attributes, err := json.Marshal(l.Attributes)
+		if err != nil {
+			return "", err
+		}
+		payload.Attributes = attributes
+	}
+
+	var res string // response from the rpc
+
+	// The service method name must exactly match the one on the rpc
+	//
+	// Must start with a capital letter to be exported (so that it works)
+	done, err := app.deps.logger.Allow()
+	if err != nil {
+		return "", err
+	}
+
+	err = app.clients.rpc.Call(ctx, "RPCServer.LogInfo", payload, &res)
+	done(rpcFailure(err))
+	if err != nil {
+		return "", err
+	}
+
+	return res, nil
+}
+
+func (app *application) logViaGRPC(ctx context.Context, l log) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	entry := &logs.Log{
+		Name:          l.Title,
+		Data:          l.Content,
+		Severity:      logs.Severity(logs.Severity_value["SEVERITY_"+l.severity()]),
+		Service:       l.Service,
+		TraceId:       l.TraceID,
+		CorrelationId: l.correlationID(ctx),
+		Tags:          l.Tags,
+		EventId:       l.eventID,
+	}
+
+	if len(l.Attributes) > 0 {
+		attributes, err := structpb.NewStruct(l.Attributes)
+		if err != nil {
+			return "", &rejectedError{status: http.StatusBadRequest, err: fmt.Errorf("invalid attributes: %w", err)}
+		}
+		entry.Attributes = attributes
+	}
+
+	done, err := app.deps.logger.Allow()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := app.clients.logs.WriteLog(outgoingIdentity(ctx), &logs.LogRequest{
+		Entry: entry,
+	})
+	done(grpcFailure(err))
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.AlreadyExists:
+		return "", &rejectedError{status: http.StatusConflict, err: errors.New(status.Convert(err).Message())}
+	case codes.InvalidArgument:
+		return "", &rejectedError{status: http.StatusBadRequest, err: errors.New(status.Convert(err).Message())}
+	default:
+		return "", err
+	}
+
+	return resp.GetResponse(), nil
+}
@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the gRPC target scheme served by GRPCResolver, e.g. "discovery:///logger-grpc".
+const Scheme = "discovery"
+
+// GRPCResolver adapts r for gRPC, so a long-lived client connection follows the service
+// when it moves. The address is refreshed every interval, and whenever gRPC asks for it
+// after a connection failure.
+func GRPCResolver(r Resolver, interval time.Duration) resolver.Builder {
+	return &grpcBuilder{r: r, interval: interval}
+}
+
+type grpcBuilder struct {
+	r        Resolver
+	interval time.Duration
+}
+
+func (b *grpcBuilder) Scheme() string {
+	return Scheme
+}
+
+func (b *grpcBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	gr := &grpcResolver{
+		r:       b.r,
+		service: target.Endpoint(),
+		cc:      cc,
+		now:     make(chan struct{}, 1),
+		cancel:  cancel,
+	}
+
+	gr.wg.Add(1)
+	go gr.watch(ctx, b.interval)
+
+	return gr, nil
+}
+
+type grpcResolver struct {
+	r       Resolver
+	service string
+	cc      resolver.ClientConn
+	now     chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func (gr *grpcResolver) watch(ctx context.Context, interval time.Duration) {
+	defer gr.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		gr.resolve(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-gr.now:
+		}
+	}
+}
+
+func (gr *grpcResolver) resolve(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	addr, err := gr.r.Resolve(ctx, gr.service)
+	if err != nil {
+		gr.cc.ReportError(err)
+		return
+	}
+
+	_ = gr.cc.UpdateState(resolver.State{
+		Addresses: []resolver.Address{{Addr: addr}},
+	})
+}
+
+func (gr *grpcResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case gr.now <- struct{}{}:
+	default:
+	}
+}
+
+func (gr *grpcResolver) Close() {
+	gr.cancel()
+	gr.wg.Wait()
+}
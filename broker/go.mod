@@ -5,8 +5,11 @@ go 1.23.4
 require (
 	github.com/go-chi/chi/v5 v5.2.0
 	github.com/go-chi/cors v1.2.1
+	github.com/golang-jwt/jwt/v5 v5.1.0
 	google.golang.org/grpc v1.70.0
 	google.golang.org/protobuf v1.36.5
+	golang.org/x/sync v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,16 @@
+package identity
+
+import "context"
+
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the caller's identity.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, or nil for anonymous callers.
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
@@ -0,0 +1,238 @@
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ziliscite/go-micro-broker/breaker"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrUnknownKey   = errors.New("token signed with an unknown key")
+)
+
+// Identity is who the caller is, as proven by their access token.
+type Identity struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Active bool   `json:"active"`
+}
+
+type claims struct {
+	Email  string `json:"email"`
+	Active bool   `json:"active"`
+	jwt.RegisteredClaims
+}
+
+// Verifier checks access tokens locally against the keys published by the authentication service.
+//
+// Keys are fetched lazily and cached. A token with a key id we haven't seen triggers a refetch,
+// which is how we pick up key rotation, but no more than once per refetchInterval. A failed fetch
+// is remembered too, the next one waits longer each time up to refetchInterval, so an outage of
+// authentication doesn't turn every request into a fetch. Requests needing a fetch at the same
+// time share it, and it goes through the authentication breaker.
+type Verifier struct {
+	jwksURL func(ctx context.Context) (string, error)
+	issuer  string
+	client  *http.Client
+	breaker *breaker.Breaker
+
+	fetches singleflight.Group
+
+	mu   sync.RWMutex
+	keys map[string]*rsa.PublicKey
+	// next is when we may fetch again, lastErr why the last fetch failed, nil when it didn't
+	next     time.Time
+	failures int
+	lastErr  error
+}
+
+const (
+	refetchInterval = 30 * time.Second
+	// failedRefetch is how long the first retry after a failed fetch waits, it doubles from there
+	failedRefetch = time.Second
+	// fetchTimeout bounds a shared fetch, it isn't tied to any one request
+	fetchTimeout = 5 * time.Second
+)
+
+// NewVerifier creates a verifier fetching keys from the URL returned by jwksURL, which is asked
+// again on every fetch so the authentication service can move around. Fetches go through b.
+func NewVerifier(jwksURL func(ctx context.Context) (string, error), issuer string, client *http.Client, b *breaker.Breaker) *Verifier {
+	return &Verifier{
+		jwksURL: jwksURL,
+		issuer:  issuer,
+		client:  client,
+		breaker: b,
+		keys:    make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Verify validates the token and returns the identity it carries.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Identity, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, ErrUnknownKey) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return &Identity{
+		UserID: c.Subject,
+		Email:  c.Email,
+		Active: c.Active,
+	}, nil
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	wait := time.Now().Before(v.next)
+	lastErr := v.lastErr
+	v.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if wait {
+		if lastErr != nil {
+			// authentication is still failing us, not the token
+			return nil, lastErr
+		}
+		return nil, ErrUnknownKey
+	}
+
+	// the fetch is shared, a request going away mustn't cancel it for the others
+	_, err, _ := v.fetches.Do("jwks", func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+		defer cancel()
+
+		return nil, v.refresh(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if key, ok = v.keys[kid]; !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// refresh fetches the keys through the breaker, and records when the next fetch may happen.
+func (v *Verifier) refresh(ctx context.Context) error {
+	v.mu.RLock()
+	wait := time.Now().Before(v.next)
+	v.mu.RUnlock()
+
+	// a fetch that finished while we were queuing for this one already did it
+	if wait {
+		return nil
+	}
+
+	err := v.breaker.Execute(func() error {
+		return v.fetch(ctx)
+	})
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err != nil {
+		v.failures++
+		v.next = time.Now().Add(min(failedRefetch<<(v.failures-1), refetchInterval))
+		v.lastErr = err
+		return err
+	}
+
+	v.failures = 0
+	v.next = time.Now().Add(refetchInterval)
+	v.lastErr = nil
+	return nil
+}
+
+func (v *Verifier) fetch(ctx context.Context) error {
+	url, err := v.jwksURL(ctx)
+	if err != nil {
+		return fmt.Errorf("locating jwks: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return fmt.Errorf("decoding jwk modulus: %w", err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return fmt.Errorf("decoding jwk exponent: %w", err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load fills cfg, a pointer to a struct, from (lowest to highest priority):
+//
+//   - the `default` tag of each field
+//   - a YAML file, named by the -config flag or the CONFIG_FILE env var, keyed by the `yaml` tags
+//   - environment variables named by the `env` tags
+//   - command line flags named by the `flag` tags
+//
+// Fields tagged `required:"true"` must end up non-zero, every missing one is reported at once.
+// Supported field types are string, bool, ints, floats, time.Duration, []string (comma separated)
+// and nested structs.
+func Load(cfg any, args []string) error {
+	root := reflect.ValueOf(cfg)
+	if root.Kind() != reflect.Pointer || root.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Load needs a pointer to a struct")
+	}
+
+	fields := collect(root.Elem(), "")
+
+	// Flags are parsed first, they may point at the config file
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+
+	flagValues := make(map[string]*string)
+	for _, f := range fields {
+		if name := f.tag("flag"); name != "" {
+			flagValues[name] = fs.String(name, "", f.usage())
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if def, ok := f.field.Tag.Lookup("default"); ok {
+			if err := f.set(def); err != nil {
+				return fmt.Errorf("config: default for %s: %w", f.path, err)
+			}
+		}
+	}
+
+	if *file != "" {
+		if err := loadFile(*file, cfg); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields {
+		name := f.tag("env")
+		if name == "" {
+			continue
+		}
+
+		if v, ok := os.LookupEnv(name); ok {
+			if err := f.set(v); err != nil {
+				return fmt.Errorf("config: env %s: %w", name, err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.tag("flag") == fl.Name && err == nil {
+				if setErr := f.set(*flagValues[fl.Name]); setErr != nil {
+					err = fmt.Errorf("config: flag -%s: %w", fl.Name, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, f := range fields {
+		if f.tag("required") == "true" && f.value.IsZero() {
+			missing = append(missing, f.describe())
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("config: missing required settings: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// Redacted returns the effective config as a map, keyed by field path, with every field tagged
+// `secret:"true"` masked. Meant for logging at startup.
+func Redacted(cfg any) map[string]any {
+	out := make(map[string]any)
+
+	for _, f := range collect(reflect.Indirect(reflect.ValueOf(cfg)), "") {
+		switch {
+		case f.tag("secret") != "true":
+			out[f.path] = f.value.Interface()
+		case f.value.IsZero():
+			out[f.path] = ""
+		default:
+			out[f.path] = "[redacted]"
+		}
+	}
+
+	return out
+}
+
+func loadFile(path string, cfg any) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer file.Close()
+
+	dec := yaml.NewDecoder(file)
+	dec.KnownFields(true)
+
+	if err = dec.Decode(cfg); err != nil {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+type field struct {
+	path  string
+	field reflect.StructField
+	value reflect.Value
+}
+
+// collect flattens the settable leaf fields of a struct, descending into nested structs.
+func collect(v reflect.Value, prefix string) []field {
+	var fields []field
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeFor[time.Duration]() {
+			fields = append(fields, collect(fv, name)...)
+			continue
+		}
+
+		fields = append(fields, field{path: name, field: sf, value: fv})
+	}
+
+	return fields
+}
+
+func (f field) tag(key string) string {
+	return f.field.Tag.Get(key)
+}
+
+func (f field) usage() string {
+	if env := f.tag("env"); env != "" {
+		return fmt.Sprintf("%s (env %s)", f.path, env)
+	}
+	return f.path
+}
+
+func (f field) describe() string {
+	var sources []string
+	if env := f.tag("env"); env != "" {
+		sources = append(sources, "env "+env)
+	}
+	if fl := f.tag("flag"); fl != "" {
+		sources = append(sources, "flag -"+fl)
+	}
+
+	if len(sources) == 0 {
+		return f.path
+	}
+	return fmt.Sprintf("%s (%s)", f.path, strings.Join(sources, ", "))
+}
+
+func (f field) set(s string) error {
+	v := f.value
+
+	if v.Type() == reflect.TypeFor[time.Duration]() {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
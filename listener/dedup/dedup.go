@@ -0,0 +1,45 @@
+// Package dedup remembers which events were already handled, so a redelivered event can be
+// acked without being handled twice.
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Store remembers event IDs for a while. It's a best effort: an ID marked on another replica or
+// forgotten after its TTL lets the event through again, so handlers still have to cope with the
+// rare duplicate, the logger does with its unique index on the event ID.
+type Store interface {
+	// Seen tells whether id was marked and hasn't expired yet.
+	Seen(ctx context.Context, id string) (bool, error)
+	// Mark remembers id until the store's TTL runs out.
+	Mark(ctx context.Context, id string) error
+	// Close releases whatever the store holds on to.
+	Close(ctx context.Context) error
+}
+
+// Options select and size the store, see New.
+type Options struct {
+	// Store is memory or mongo
+	Store string
+	// TTL is how long an ID is remembered, keep it well above how long an event can sit in the queue
+	TTL time.Duration
+	// Size caps how many IDs the memory store keeps, the least recently used go first
+	Size int
+
+	Mongo MongoOptions
+}
+
+// New creates the store selected by opts.Store.
+func New(ctx context.Context, opts Options) (Store, error) {
+	switch opts.Store {
+	case "memory", "":
+		return NewMemory(opts.Size, opts.TTL), nil
+	case "mongo":
+		return NewMongo(ctx, opts.Mongo, opts.TTL)
+	default:
+		return nil, fmt.Errorf("unknown dedup store %q, want memory or mongo", opts.Store)
+	}
+}
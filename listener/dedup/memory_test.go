@@ -0,0 +1,101 @@
+package dedup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryTTL(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(10, 20*time.Millisecond)
+
+	if seen, _ := m.Seen(ctx, "a"); seen {
+		t.Fatal("Seen() before Mark() = true")
+	}
+
+	_ = m.Mark(ctx, "a")
+	if seen, _ := m.Seen(ctx, "a"); !seen {
+		t.Fatal("Seen() right after Mark() = false")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if seen, _ := m.Seen(ctx, "a"); seen {
+		t.Error("Seen() past the TTL = true")
+	}
+	if _, ok := m.ids["a"]; ok {
+		t.Error("an expired ID is still held")
+	}
+}
+
+func TestMemoryMarkExtendsTTL(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(10, 40*time.Millisecond)
+
+	_ = m.Mark(ctx, "a")
+	time.Sleep(25 * time.Millisecond)
+	_ = m.Mark(ctx, "a")
+	time.Sleep(25 * time.Millisecond)
+
+	if seen, _ := m.Seen(ctx, "a"); !seen {
+		t.Error("Seen() within the TTL of the second Mark() = false")
+	}
+}
+
+func TestMemoryEviction(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		ops  []string // "mark x" or "seen x"
+		want map[string]bool
+	}{
+		{
+			name: "oldest goes first",
+			size: 2,
+			ops:  []string{"mark a", "mark b", "mark c"},
+			want: map[string]bool{"a": false, "b": true, "c": true},
+		},
+		{
+			name: "seen counts as a use",
+			size: 2,
+			ops:  []string{"mark a", "mark b", "seen a", "mark c"},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "marking again counts as a use",
+			size: 2,
+			ops:  []string{"mark a", "mark b", "mark a", "mark c"},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "size below one keeps one",
+			size: 0,
+			ops:  []string{"mark a", "mark b"},
+			want: map[string]bool{"a": false, "b": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := NewMemory(tt.size, time.Hour)
+
+			for _, op := range tt.ops {
+				verb, id, _ := strings.Cut(op, " ")
+				if verb == "mark" {
+					_ = m.Mark(ctx, id)
+				} else {
+					_, _ = m.Seen(ctx, id)
+				}
+			}
+
+			// check the held IDs directly, Seen would reorder them
+			for id, want := range tt.want {
+				if _, got := m.ids[id]; got != want {
+					t.Errorf("%s held = %v, want %v", id, got, want)
+				}
+			}
+		})
+	}
+}
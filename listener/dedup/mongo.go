@@ -0,0 +1,91 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoOptions is where the Mongo store keeps the IDs.
+type MongoOptions struct {
+	URL        string
+	Username   string
+	Password   string
+	Database   string
+	Collection string
+}
+
+// Mongo is a Store shared by every listener replica, surviving restarts. Mongo's TTL monitor
+// deletes the expired IDs, it only runs every minute or so, which is why Seen checks the expiry too.
+type Mongo struct {
+	client *mongo.Client
+	mc     *mongo.Collection
+	ttl    time.Duration
+}
+
+type processed struct {
+	ID        string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// NewMongo connects to mongo and makes sure the collection expires its IDs.
+func NewMongo(ctx context.Context, opts MongoOptions, ttl time.Duration) (*Mongo, error) {
+	clientOpts := options.Client().ApplyURI(opts.URL)
+	if opts.Username != "" {
+		clientOpts.SetAuth(options.Credential{
+			Username: opts.Username,
+			Password: opts.Password,
+		})
+	}
+
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	mc := client.Database(opts.Database).Collection(opts.Collection)
+
+	// documents go once their expires_at is in the past
+	if _, err = mc.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}); err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, err
+	}
+
+	return &Mongo{
+		client: client,
+		mc:     mc,
+		ttl:    ttl,
+	}, nil
+}
+
+func (m *Mongo) Seen(ctx context.Context, id string) (bool, error) {
+	var p processed
+	err := m.mc.FindOne(ctx, bson.M{"_id": id}).Decode(&p)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return time.Now().Before(p.ExpiresAt), nil
+}
+
+func (m *Mongo) Mark(ctx context.Context, id string) error {
+	_, err := m.mc.UpdateByID(ctx, id,
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(m.ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (m *Mongo) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
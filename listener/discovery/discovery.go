@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrServiceNotFound = errors.New("service not found")
+
+// Resolver finds where a service currently lives.
+//
+// Services are known by a logical name, like "logger" or "logger-grpc", and resolve to a
+// host:port. Callers should resolve right before connecting rather than caching the result,
+// so a relocated or scaled service is picked up without a restart.
+type Resolver interface {
+	Resolve(ctx context.Context, service string) (string, error)
+}
+
+// URL resolves service and returns an http URL for path on it.
+func URL(ctx context.Context, r Resolver, service, path string) (string, error) {
+	addr, err := r.Resolve(ctx, service)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("http://%s%s", addr, path), nil
+}
+
+// Chain tries each resolver in order and returns the first address found.
+type Chain []Resolver
+
+func (c Chain) Resolve(ctx context.Context, service string) (string, error) {
+	var errs []error
+	for _, r := range c {
+		addr, err := r.Resolve(ctx, service)
+		if err == nil {
+			return addr, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return "", fmt.Errorf("%w: %s: %v", ErrServiceNotFound, service, errors.Join(errs...))
+}
+
+// Options select and configure a provider.
+//
+//	static: the defaults, overridden by Static="logger=localhost:8002,mailer=localhost:8003"
+//	dns:    SRV records under Domain, e.g. _logger._tcp.service.consul
+//	file:   a JSON file at File, re-read whenever it changes
+type Options struct {
+	Provider string
+	Static   string
+	Domain   string
+	File     string
+}
+
+// New builds the resolver selected by opts, always falling back to the static defaults
+// (the docker compose hostnames).
+func New(opts Options, defaults map[string]string) (Resolver, error) {
+	static, err := ParseStatic(opts.Static)
+	if err != nil {
+		return nil, err
+	}
+
+	for service, addr := range defaults {
+		if _, ok := static[service]; !ok {
+			static[service] = addr
+		}
+	}
+
+	switch provider := strings.ToLower(opts.Provider); provider {
+	case "", "static":
+		return static, nil
+	case "dns":
+		if opts.Domain == "" {
+			return nil, errors.New("a domain must be set for the dns discovery provider")
+		}
+		return Chain{NewSRV(opts.Domain), static}, nil
+	case "file":
+		if opts.File == "" {
+			return nil, errors.New("a file must be set for the file discovery provider")
+		}
+		return Chain{NewFile(opts.File), static}, nil
+	default:
+		return nil, fmt.Errorf("unknown discovery provider %q", provider)
+	}
+}
@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// File resolves services from a JSON file, handy for running services outside docker compose:
+//
+//	{"logger": ["localhost:8002"], "logger-grpc": ["localhost:50001", "localhost:50002"]}
+//
+// The file is re-read whenever its modification time changes, and services with several
+// addresses are handed out round-robin.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	entries map[string][]string
+	next    map[string]int
+}
+
+func NewFile(path string) *File {
+	return &File{
+		path: path,
+		next: make(map[string]int),
+	}
+}
+
+func (f *File) Resolve(_ context.Context, service string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return "", err
+	}
+
+	addrs := f.entries[service]
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrServiceNotFound, service)
+	}
+
+	i := f.next[service] % len(addrs)
+	f.next[service] = i + 1
+
+	return addrs[i], nil
+}
+
+func (f *File) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("reading discovery file: %w", err)
+	}
+
+	if f.entries != nil && info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("reading discovery file: %w", err)
+	}
+
+	var entries map[string][]string
+	if err = json.Unmarshal(b, &entries); err != nil {
+		return fmt.Errorf("parsing discovery file: %w", err)
+	}
+
+	f.entries = entries
+	f.modTime = info.ModTime()
+
+	return nil
+}
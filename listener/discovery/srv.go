@@ -0,0 +1,68 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SRV resolves services with DNS SRV records, _<service>._tcp.<domain>, the way
+// Consul, Kubernetes headless services and most DNS based registries publish them.
+type SRV struct {
+	domain   string
+	resolver *net.Resolver
+}
+
+func NewSRV(domain string) *SRV {
+	return &SRV{
+		domain:   domain,
+		resolver: net.DefaultResolver,
+	}
+}
+
+func (s *SRV) Resolve(ctx context.Context, service string) (string, error) {
+	_, records, err := s.resolver.LookupSRV(ctx, service, "tcp", s.domain)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrServiceNotFound, service, err)
+	}
+
+	if len(records) == 0 {
+		return "", fmt.Errorf("%w: %s: no SRV records", ErrServiceNotFound, service)
+	}
+
+	target := pick(records)
+	return net.JoinHostPort(strings.TrimSuffix(target.Target, "."), strconv.Itoa(int(target.Port))), nil
+}
+
+// pick chooses among the records with the lowest priority, weighted at random (RFC 2782).
+// LookupSRV already sorts them by priority.
+func pick(records []*net.SRV) *net.SRV {
+	lowest := records[0].Priority
+
+	var candidates []*net.SRV
+	total := 0
+	for _, r := range records {
+		if r.Priority != lowest {
+			break
+		}
+		candidates = append(candidates, r)
+		total += int(r.Weight)
+	}
+
+	if total == 0 {
+		return candidates[rand.IntN(len(candidates))]
+	}
+
+	n := rand.IntN(total)
+	for _, r := range candidates {
+		n -= int(r.Weight)
+		if n < 0 {
+			return r
+		}
+	}
+
+	return candidates[0]
+}
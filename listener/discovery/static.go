@@ -0,0 +1,37 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Static resolves services from a fixed map of service name to host:port.
+type Static map[string]string
+
+func (s Static) Resolve(_ context.Context, service string) (string, error) {
+	addr, ok := s[service]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrServiceNotFound, service)
+	}
+
+	return addr, nil
+}
+
+// ParseStatic reads a list like "logger=localhost:8002,mailer=localhost:8003".
+func ParseStatic(s string) (Static, error) {
+	static := make(Static)
+	if strings.TrimSpace(s) == "" {
+		return static, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		service, addr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || service == "" || addr == "" {
+			return nil, fmt.Errorf("invalid static discovery entry %q, expected service=host:port", pair)
+		}
+		static[service] = addr
+	}
+
+	return static, nil
+}
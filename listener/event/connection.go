@@ -0,0 +1,179 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrDisconnected means rabbitmq is unreachable right now, the connection is being re-dialed.
+var ErrDisconnected = errors.New("not connected to rabbitmq")
+
+// maxBackoff caps the wait between two dial attempts once connected the first time
+const maxBackoff = 30 * time.Second
+
+// Connection keeps a connection to rabbitmq alive. When it drops, it's dialed again with backoff
+// until it's back or Close is called, and channels can be opened again from then on.
+//
+// Channels opened on a lost connection stay closed, users of Channel notice when they get one
+// back that's closed or an error, and open a new one once Ready.
+type Connection struct {
+	url string
+
+	mu    sync.Mutex
+	conn  *amqp.Connection
+	ready chan struct{} // closed while conn is usable
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to rabbitmq, trying a few times with backoff since it may still be starting up,
+// and keeps the connection alive from then on.
+func Dial(url string) (*Connection, error) {
+	counts := 0
+	backOff := 1 * time.Second
+	var conn *amqp.Connection
+
+	for {
+		c, err := amqp.Dial(url)
+		if err != nil {
+			slog.Error("Rabbitmq not ready", "error", err)
+			counts++
+		} else {
+			conn = c
+			break
+		}
+
+		if counts > 5 {
+			slog.Error("Failed to connect to rabbitmq", "error", err)
+			return nil, err
+		}
+
+		backOff = time.Duration(math.Pow(float64(counts), 2)) * time.Second
+		time.Sleep(backOff)
+	}
+
+	slog.Info("Connected to rabbitmq")
+
+	ready := make(chan struct{})
+	close(ready)
+
+	c := &Connection{
+		url:     url,
+		conn:    conn,
+		ready:   ready,
+		closing: make(chan struct{}),
+	}
+
+	go c.supervise(conn)
+
+	return c, nil
+}
+
+// Channel opens a channel on the current connection, failing with ErrDisconnected while it's down.
+func (c *Connection) Channel() (*amqp.Channel, error) {
+	c.mu.Lock()
+	conn, ready := c.conn, c.ready
+	c.mu.Unlock()
+
+	select {
+	case <-ready:
+		return conn.Channel()
+	default:
+		return nil, ErrDisconnected
+	}
+}
+
+// Ready blocks until the connection is up, or ctx is done or the connection closed for good.
+func (c *Connection) Ready(ctx context.Context) error {
+	c.mu.Lock()
+	ready := c.ready
+	c.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-c.closing:
+		return amqp.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the connection and stops reconnecting.
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn.Close()
+}
+
+func (c *Connection) supervise(conn *amqp.Connection) {
+	for {
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		select {
+		case <-c.closing:
+			return
+		case err := <-closed:
+			select {
+			case <-c.closing:
+				return
+			default:
+			}
+			slog.Warn("Lost connection to rabbitmq, reconnecting", "error", err)
+		}
+
+		c.mu.Lock()
+		c.ready = make(chan struct{})
+		c.mu.Unlock()
+
+		if conn = c.redial(); conn == nil {
+			return
+		}
+
+		c.mu.Lock()
+		select {
+		case <-c.closing:
+			// Close ran while we were dialing, it closed the old connection and not this one
+			c.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+
+		c.conn = conn
+		close(c.ready)
+		c.mu.Unlock()
+
+		slog.Info("Reconnected to rabbitmq")
+	}
+}
+
+// redial dials until it succeeds, returning nil if the connection is closed in the meantime.
+func (c *Connection) redial() *amqp.Connection {
+	backOff := time.Second
+	for {
+		select {
+		case <-c.closing:
+			return nil
+		case <-time.After(backOff):
+		}
+
+		conn, err := amqp.Dial(c.url)
+		if err == nil {
+			return conn
+		}
+
+		slog.Warn("Rabbitmq still unreachable", "error", err, "retry_in", backOff)
+		backOff = min(backOff*2, maxBackoff)
+	}
+}
@@ -2,22 +2,64 @@ package event
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/ziliscite/go-micro-listener/dedup"
+	"github.com/ziliscite/go-micro-listener/discovery"
 	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
+// consumerTag names our consumer on the channel, so it can be cancelled on shutdown
+const consumerTag = "listener"
+
+// errPoison marks an event that will never be handled, no matter how many times it's retried.
+// Those go straight to the dead-letter queue.
+var errPoison = errors.New("event can't be handled")
+
+// QueueOptions describe the durable queue the consumer reads from.
+type QueueOptions struct {
+	Name string
+	// MaxDeliveries is how many times an event is tried before it's dead-lettered
+	MaxDeliveries int
+	// RetryDelay is how long a failed event is held before it goes back on the queue
+	RetryDelay time.Duration
+
+	// Workers is how many events are handled at the same time
+	Workers int
+	// Prefetch is how many unacked events rabbitmq hands us at once, the rest wait in the queue
+	Prefetch int
+}
+
 // Consumer receives events
 type Consumer struct {
-	conn *amqp.Connection
-	qn   string // queue name
+	conn     *Connection
+	ch       *amqp.Channel // acks must go through the channel the deliveries came from
+	queue    QueueOptions
+	resolver discovery.Resolver
+	router   router
+	// handled remembers the events already handled, so redeliveries are only acked
+	handled dedup.Store
+
+	// workers still running, waited for on shutdown
+	handling sync.WaitGroup
+	// closed once Listen returns, no workers are started after that
+	stopped chan struct{}
 }
 
-func NewConsumer(conn *amqp.Connection) (*Consumer, error) {
+func NewConsumer(conn *Connection, resolver discovery.Resolver, queue QueueOptions, handled dedup.Store) (*Consumer, error) {
 	c := &Consumer{
-		conn: conn,
+		conn:     conn,
+		queue:    queue,
+		resolver: resolver,
+		handled:  handled,
+		stopped:  make(chan struct{}),
 	}
 
 	channel, err := conn.Channel()
@@ -31,92 +73,361 @@ func NewConsumer(conn *amqp.Connection) (*Consumer, error) {
 		return nil, err
 	}
 
+	if err = declareDeadLetter(channel); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
 
+// payload is a log entry, as published on log.* and as the logger takes it
 type payload struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	// EventID lets the logger spot an event written twice
+	EventID  string `json:"event_id,omitempty"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Severity string `json:"severity,omitempty"`
+
+	Service       string         `json:"service,omitempty"`
+	TraceID       string         `json:"trace_id,omitempty"`
+	CorrelationID string         `json:"correlation_id,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+}
+
+// Handle routes deliveries whose routing key matches pattern to h, see router for the syntax.
+// The queue is bound with every pattern, so register them all before calling Listen.
+func (c *Consumer) Handle(pattern string, h HandlerFunc) {
+	c.router.handle(pattern, h)
+}
+
+// Listen consumes events for the registered patterns until ctx is done. It then stops taking deliveries and
+// returns, call Shutdown to wait for the events already taken to be handled.
+//
+// When the connection drops, Listen waits for it to come back and starts over, declaring and binding
+// everything again. Deliveries that weren't acked yet are handed out again by rabbitmq.
+func (c *Consumer) Listen(ctx context.Context) error {
+	topics := c.router.patterns()
+	if len(topics) == 0 {
+		return errors.New("no handlers registered")
+	}
+
+	defer close(c.stopped)
+	go c.pollDepth(ctx)
+
+	backOff := time.Second
+	for {
+		consumed, err := c.consume(ctx, topics)
+		if ctx.Err() != nil {
+			return err
+		}
+
+		if consumed {
+			backOff = time.Second
+		}
+
+		slog.Warn("Stopped consuming, resuming once rabbitmq is back", "error", err, "retry_in", backOff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backOff):
+		}
+		backOff = min(backOff*2, maxBackoff)
+
+		if err = c.conn.Ready(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
 }
 
-func (c *Consumer) Listen(topics []string) error {
-	// get a channel
+// consume runs one session on a fresh channel, until ctx is done or the channel is lost. It
+// reports whether it got as far as consuming.
+func (c *Consumer) consume(ctx context.Context, topics []string) (bool, error) {
+	// get a channel, closed by Shutdown once every delivery is acked
 	ch, err := c.conn.Channel()
 	if err != nil {
-		return err
+		return false, err
+	}
+	c.ch = ch
+
+	// rabbitmq stops sending once this many deliveries are unacked, which keeps the backlog in
+	// the queue instead of in our memory
+	if err = ch.Qos(c.queue.Prefetch, 0, false); err != nil {
+		return false, err
+	}
+
+	// rabbitmq may have come back without them
+	if err = declareExchange(ch); err != nil {
+		return false, err
+	}
+
+	if err = declareDeadLetter(ch); err != nil {
+		return false, err
 	}
-	defer ch.Close()
 
 	// get a queue
-	q, err := declareQueue(ch)
+	q, err := declareQueue(ch, c.queue.Name, c.queue.MaxDeliveries)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	for _, s := range topics {
 		// bind channels to each of these topics
 		// channel bind s to a queue
 		if err = bindQueueToExchange(ch, q.Name, s); err != nil {
-			return err
+			return false, err
 		}
 	}
 
 	// look for messages
 	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		true,   // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
+		q.Name,      // queue
+		consumerTag, // consumer
+		false,       // auto-ack, we ack once the event is handled
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
 	)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// consume til application exits
-	forever := make(chan bool)
+	// consume til we're told to stop, never handling more than Workers events at a time
+	var session sync.WaitGroup
+	for range max(c.queue.Workers, 1) {
+		c.handling.Add(1)
+		session.Add(1)
+		go func() {
+			defer c.handling.Done()
+			defer session.Done()
+
+			for m := range msgs {
+				c.handle(m)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
 	go func() {
-		for m := range msgs {
-			var p payload
-			// encode payload
-			_ = json.Unmarshal(m.Body, &p)
+		session.Wait()
+		close(done)
+	}()
 
-			go handlePayload(p)
+	slog.Info("Listening for events [Exchange, Queue]", "logs_topic", q.Name, "workers", c.queue.Workers, "prefetch", c.queue.Prefetch)
+
+	select {
+	case <-done:
+		return true, errors.New("rabbitmq closed the delivery channel")
+	case <-ctx.Done():
+	}
+
+	// stop deliveries, the workers finish the ones already sent our way, see Shutdown
+	return true, ch.Cancel(consumerTag, false)
+}
+
+// pollDepth keeps the queue depth metric up to date until ctx is done.
+func (c *Consumer) pollDepth(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
+
+		// a failed passive declare closes the channel, so use a throwaway one
+		ch, err := c.conn.Channel()
+		if err != nil {
+			slog.Warn("Failed to poll queue depth", "error", err)
+			continue
+		}
+
+		q, err := ch.QueueDeclarePassive(c.queue.Name, true, false, false, false, nil)
+		if err != nil {
+			slog.Warn("Failed to poll queue depth", "error", err)
+		} else {
+			metrics.queueDepth.Set(int64(q.Messages))
+		}
+
+		_ = ch.Close()
+	}
+}
+
+// Shutdown waits for the workers to handle the events Listen already took, for as long as ctx allows.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	// Listen may still be setting up a session, wait for it to give up before counting workers
+	select {
+	case <-c.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	handled := make(chan struct{})
+	go func() {
+		c.handling.Wait()
+		close(handled)
 	}()
 
-	slog.Info("Listening for events [Exchange, Queue]", "logs_topic", q.Name)
-	<-forever
+	var err error
+	select {
+	case <-handled:
+	case <-ctx.Done():
+		// whatever is left unacked goes back on the queue when the channel closes
+		err = ctx.Err()
+	}
+
+	// the channel is already gone if the connection dropped
+	if c.ch != nil && !c.ch.IsClosed() {
+		err = errors.Join(err, c.ch.Close())
+	}
 
-	return nil
+	return err
 }
 
-func handlePayload(p payload) {
-	switch p.Title {
-	//case "log", "event":
-	// when queue is a log or event
-	case "auth":
-		// some auth logic when something happens
-	default:
-		err := logEvent(p)
-		if err != nil {
-			slog.Error("Failed to log event", "error", err)
+// handle acks the delivery once the event is handled. Failed ones are put back on the queue after
+// a while, unless they are poison, then they're dead-lettered right away. The queue dead-letters
+// the ones that keep failing by itself, see declareQueue.
+func (c *Consumer) handle(m amqp.Delivery) {
+	metrics.received.Add(1)
+	metrics.inFlight.Add(1)
+	defer metrics.inFlight.Add(-1)
+
+	start := time.Now()
+
+	e, err := Decode(m)
+	if err == nil && c.seen(e.ID) {
+		metrics.duplicates.Add(1)
+		slog.Info("Skipping event already handled", "routing_key", m.RoutingKey, "message_id", e.ID)
+
+		if err = m.Ack(false); err != nil {
+			slog.Error("Failed to settle delivery", "error", err)
 		}
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("%w: %v", errPoison, err)
+	} else if h, ok := c.router.match(m.RoutingKey); ok {
+		err = h(context.Background(), e)
+	} else {
+		err = fmt.Errorf("%w: no handler for routing key %q", errPoison, m.RoutingKey)
+	}
+
+	metrics.latency.Observe(time.Since(start))
+
+	// quorum queues count the deliveries for us
+	deliveries, _ := m.Headers["x-delivery-count"].(int64)
+
+	switch {
+	case err == nil:
+		c.remember(e.ID)
+		metrics.acked.Add(1)
+		err = m.Ack(false)
+	case errors.Is(err, errPoison):
+		metrics.deadLettered.Add(1)
+		slog.Error("Dead-lettering event", "routing_key", m.RoutingKey, "message_id", m.MessageId, "error", err)
+		err = m.Nack(false, false)
+	default:
+		metrics.retried.Add(1)
+		slog.Warn("Failed to handle event, retrying", "routing_key", m.RoutingKey, "message_id", m.MessageId, "delivery", deliveries+1, "max_deliveries", c.queue.MaxDeliveries, "error", err)
+		time.Sleep(c.queue.RetryDelay)
+		err = m.Nack(false, true)
+	}
+
+	if err != nil {
+		slog.Error("Failed to settle delivery", "error", err)
 	}
 }
 
-// stub handler -- log event when receive some from rabbitmq
-func logEvent(entry payload) error {
+// seen tells whether the event was already handled. When the store can't tell, it's handled
+// again, better than losing it.
+func (c *Consumer) seen(id string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	seen, err := c.handled.Seen(ctx, id)
+	if err != nil {
+		slog.Warn("Failed to check for duplicate event", "message_id", id, "error", err)
+	}
+
+	return seen
+}
+
+// remember marks the event as handled, so it's skipped if it's delivered again.
+func (c *Consumer) remember(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.handled.Mark(ctx, id); err != nil {
+		slog.Warn("Failed to remember handled event", "message_id", id, "error", err)
+	}
+}
+
+// LogEvent writes the event to the logger, with the severity taken from its type.
+func (c *Consumer) LogEvent(ctx context.Context, e Envelope) error {
+	var entry payload
+	if err := json.Unmarshal(e.Payload, &entry); err != nil {
+		return fmt.Errorf("%w: decoding payload: %v", errPoison, err)
+	}
+
+	entry.EventID = e.ID
+	entry.Severity = severity(e.Type)
+	if entry.CorrelationID == "" {
+		entry.CorrelationID = e.CorrelationID
+	}
+
+	return c.writeLog(ctx, entry)
+}
+
+// AuditEvent writes a typed event, like auth.login.failed, to the logger: titled by its type,
+// tagged audit, with its payload as the attributes. Refused logins are warnings, everything else
+// is info.
+func (c *Consumer) AuditEvent(ctx context.Context, e Envelope) error {
+	entry := payload{
+		EventID:       e.ID,
+		Title:         e.Type,
+		Severity:      "INFO",
+		Service:       e.Source,
+		CorrelationID: e.CorrelationID,
+		Tags:          []string{"audit"},
+	}
+
+	if err := json.Unmarshal(e.Payload, &entry.Attributes); err != nil {
+		// not an object, keep it as it is
+		entry.Content = string(e.Payload)
+	}
+
+	if strings.HasSuffix(e.Type, ".failed") {
+		entry.Severity = "WARN"
+	}
+
+	return c.writeLog(ctx, entry)
+}
+
+func (c *Consumer) writeLog(ctx context.Context, entry payload) error {
 	// Create the payload
 	p, err := json.Marshal(entry)
 	if err != nil {
 		return err
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	url, err := discovery.URL(ctx, c.resolver, "logger", "/v1/logs")
+	if err != nil {
+		return err
+	}
+
 	// Now http, later rpc
-	req, err := http.NewRequest(http.MethodPost, "http://logger/v1/logs", bytes.NewBuffer(p))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(p))
 	if err != nil {
 		return err
 	}
@@ -131,10 +442,13 @@ func logEvent(entry payload) error {
 
 	var message string
 	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		// OK means it was written before, by an earlier delivery
 	case http.StatusConflict:
 		message = "a conflict occurred"
 	case http.StatusBadRequest:
-		message = "invalid log data"
+		// the logger will never take it, don't bother retrying
+		return fmt.Errorf("%w: invalid log data", errPoison)
 	case http.StatusGatewayTimeout:
 		message = "gateway timeout"
 	case http.StatusNotFound:
@@ -144,7 +458,7 @@ func logEvent(entry payload) error {
 	}
 
 	// Check the status code
-	if resp.StatusCode != http.StatusAccepted {
+	if message != "" {
 		return errors.New(message)
 	}
 
@@ -16,15 +16,66 @@ func declareExchange(channel *amqp.Channel) error {
 	)
 }
 
-// Declare a random queue
-func declareQueue(channel *amqp.Channel) (amqp.Queue, error) {
+// deadLetterExchange receives the events we gave up on, and routes them to deadLetterQueue
+const (
+	deadLetterExchange = "logs_dlx"
+	deadLetterQueue    = "logs.dead"
+)
+
+// Declare the dead-letter exchange and the queue that keeps poison messages around for inspection
+func declareDeadLetter(channel *amqp.Channel) error {
+	err := channel.ExchangeDeclare(
+		deadLetterExchange, // name of the exchange
+		"fanout",           // type, everything dead ends up in the same place
+		true,               // durable
+		false,              // auto-deleted
+		false,              // internal
+		false,              // no-wait
+		nil,                // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err = channel.QueueDeclare(
+		deadLetterQueue, // name of the queue
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive
+		false,           // no-wait
+		amqp.Table{amqp.QueueTypeArg: amqp.QueueTypeQuorum},
+	); err != nil {
+		return err
+	}
+
+	return channel.QueueBind(
+		deadLetterQueue,    // name of the queue
+		"",                 // routing key, ignored by fanout
+		deadLetterExchange, // exchange
+		false,              // no-wait
+		nil,                // arguments
+	)
+}
+
+// Declare a named, durable queue which outlives the listener, so nothing is lost while it restarts
+//
+// It's a quorum queue, which counts how many times each message was handed out. Once a message
+// is delivered maxDeliveries times without being acked, it is moved to the dead-letter exchange.
+func declareQueue(channel *amqp.Channel, name string, maxDeliveries int) (amqp.Queue, error) {
 	return channel.QueueDeclare(
-		"",    // name of the queue
-		false, // durable
-		false, // delete when we're done, not auto
-		true,  // exclusive channel for current operation, don't share it
+		name,  // name of the queue
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive, other listener replicas share the work
 		false, // no-wait
-		nil,   // arguments
+		amqp.Table{
+			amqp.QueueTypeArg:        amqp.QueueTypeQuorum,
+			"x-delivery-limit":       maxDeliveries,
+			"x-dead-letter-exchange": deadLetterExchange,
+			// at-least-once dead-lettering needs reject-publish, so nothing is dropped on the way
+			"x-dead-letter-strategy": "at-least-once",
+			amqp.QueueOverflowArg:    amqp.QueueOverflowRejectPublish,
+		},
 	)
 }
 
@@ -0,0 +1,109 @@
+package event
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// metrics are published with expvar under "listener", see /debug/vars.
+var metrics = struct {
+	received     *expvar.Int
+	acked        *expvar.Int
+	retried      *expvar.Int
+	deadLettered *expvar.Int
+	// redeliveries of events already handled, acked without handling them again
+	duplicates *expvar.Int
+
+	// deliveries being handled right now, at most one per worker
+	inFlight *expvar.Int
+	// messages ready in the queue, as of the last poll
+	queueDepth *expvar.Int
+
+	latency *histogram
+}{
+	received:     new(expvar.Int),
+	acked:        new(expvar.Int),
+	retried:      new(expvar.Int),
+	deadLettered: new(expvar.Int),
+	duplicates:   new(expvar.Int),
+	inFlight:     new(expvar.Int),
+	queueDepth:   new(expvar.Int),
+	latency: newHistogram(
+		5*time.Millisecond, 10*time.Millisecond, 25*time.Millisecond, 50*time.Millisecond,
+		100*time.Millisecond, 250*time.Millisecond, 500*time.Millisecond, time.Second, 5*time.Second,
+	),
+}
+
+func init() {
+	m := expvar.NewMap("listener")
+	m.Set("received", metrics.received)
+	m.Set("acked", metrics.acked)
+	m.Set("retried", metrics.retried)
+	m.Set("dead_lettered", metrics.deadLettered)
+	m.Set("duplicates", metrics.duplicates)
+	m.Set("in_flight", metrics.inFlight)
+	m.Set("queue_depth", metrics.queueDepth)
+	m.Set("processing_latency", metrics.latency)
+}
+
+// histogram counts durations into buckets, each holding the observations up to its bound.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []time.Duration
+	counts []int64 // one more than bounds, for everything slower than the last one
+	count  int64
+	sum    time.Duration
+}
+
+func newHistogram(bounds ...time.Duration) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) Observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+
+	h.counts[i]++
+	h.count++
+	h.sum += d
+}
+
+// String renders the histogram as JSON, which is what expvar expects.
+func (h *histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]int64, len(h.counts))
+	for i, n := range h.counts {
+		if i < len(h.bounds) {
+			buckets[fmt.Sprintf("le_%s", h.bounds[i])] = n
+			continue
+		}
+		buckets["inf"] = n
+	}
+
+	var avg float64
+	if h.count > 0 {
+		avg = float64(h.sum.Milliseconds()) / float64(h.count)
+	}
+
+	b, _ := json.Marshal(map[string]any{
+		"count":   h.count,
+		"sum_ms":  h.sum.Milliseconds(),
+		"avg_ms":  avg,
+		"buckets": buckets,
+	})
+
+	return string(b)
+}
@@ -0,0 +1,87 @@
+package event
+
+import (
+	"context"
+	"strings"
+)
+
+// HandlerFunc handles one event. Returning an error wrapping errPoison dead-letters it, any
+// other error puts it back on the queue for another try.
+type HandlerFunc func(ctx context.Context, e Envelope) error
+
+type route struct {
+	pattern string
+	words   []string
+	handler HandlerFunc
+}
+
+// router picks a handler by routing key, with the same patterns as a topic exchange binding:
+// words are separated by dots, * matches exactly one word and # matches zero or more.
+//
+//	log.*   matches log.INFO, not log or log.auth.INFO
+//	auth.#  matches auth, auth.login and auth.login.failed
+//
+// Routes are tried in the order they were added, the first match wins.
+type router struct {
+	routes []route
+}
+
+func (r *router) handle(pattern string, h HandlerFunc) {
+	r.routes = append(r.routes, route{
+		pattern: pattern,
+		words:   strings.Split(pattern, "."),
+		handler: h,
+	})
+}
+
+func (r *router) match(key string) (HandlerFunc, bool) {
+	words := strings.Split(key, ".")
+	for _, rt := range r.routes {
+		if matchTopic(rt.words, words) {
+			return rt.handler, true
+		}
+	}
+
+	return nil, false
+}
+
+// patterns are what the queue has to be bound with to receive everything the routes handle.
+func (r *router) patterns() []string {
+	patterns := make([]string, 0, len(r.routes))
+	for _, rt := range r.routes {
+		patterns = append(patterns, rt.pattern)
+	}
+	return patterns
+}
+
+func matchTopic(pattern, key []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			// try every number of words # could stand for
+			for i := 0; i <= len(key); i++ {
+				if matchTopic(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(key) == 0 {
+				return false
+			}
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+		}
+
+		pattern, key = pattern[1:], key[1:]
+	}
+
+	return len(key) == 0
+}
+
+// severity is the last word of a routing key, log.WARN gives WARN.
+func severity(key string) string {
+	return key[strings.LastIndex(key, ".")+1:]
+}
@@ -0,0 +1,59 @@
+package event
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"log.INFO", "log.INFO", true},
+		{"log.INFO", "log.WARN", false},
+		{"log.INFO", "log.INFO.extra", false},
+
+		// * is exactly one word
+		{"log.*", "log.INFO", true},
+		{"log.*", "log", false},
+		{"log.*", "log.INFO.extra", false},
+		{"*.reset", "auth.reset", true},
+		{"*.*", "auth.password", true},
+
+		// # is zero or more words
+		{"log.#", "log", true},
+		{"log.#", "log.INFO", true},
+		{"log.#", "log.INFO.extra.more", true},
+		{"log.#", "mail.send", false},
+		{"#", "log.INFO", true},
+		{"#", "", true},
+
+		// # in the middle
+		{"auth.#.reset", "auth.reset", true},
+		{"auth.#.reset", "auth.password.reset", true},
+		{"auth.#.reset", "auth.user.password.reset", true},
+		{"auth.#.reset", "auth.password.changed", false},
+		{"auth.#.*", "auth", false},
+		{"auth.#.*", "auth.login", true},
+		{"#.#", "auth.login.failed", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.key, func(t *testing.T) {
+			got := matchTopic(words(tt.pattern), words(tt.key))
+			if got != tt.want {
+				t.Errorf("matchTopic(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+// words splits s into the words matchTopic takes, "" being none at all.
+func words(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ".")
+}
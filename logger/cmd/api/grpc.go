@@ -2,13 +2,31 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/ziliscite/go-micro-logger/internal/data"
 	genproto "github.com/ziliscite/go-micro-logger/proto/genproto"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/ziliscite/go-micro-logger/internal/repository"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Limits of the batch RPCs
+const (
+	// maxWriteBatch is how many entries WriteLogs takes at once
+	maxWriteBatch = 1000
+	// ingestBatch is how many streamed entries IngestLogs writes at once
+	ingestBatch = 100
 )
 
 type LogServer struct {
@@ -29,28 +47,356 @@ func (l *LogServer) WriteLog(ctx context.Context, req *genproto.LogRequest) (*ge
 	// Get the log entry [entry here the method signature in proto file]
 	input := req.GetEntry()
 
-	var msg string
-	err := l.repo.Insert(ctx, &data.Entry{
-		Title:     input.Name,
-		Content:   input.Data,
-		CreatedAt: time.Now(),
-	})
+	entry := entryFromProto(input)
+	err := l.repo.Insert(ctx, entry)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) && input.GetEventId() != "" {
+			// the event was delivered again, it's logged already
+			return &genproto.LogResponse{Response: fmt.Sprintf("%s is already Logged!", input.GetName())}, nil
+		}
+		return nil, grpcError(err)
+	}
+
+	return &genproto.LogResponse{
+		Response: fmt.Sprintf("%s is successfully Logged!", input.GetName()),
+		Id:       entry.ID,
+	}, nil
+}
+
+// WriteLogs writes the batch in one go, reporting how each entry went.
+func (l *LogServer) WriteLogs(ctx context.Context, req *genproto.WriteLogsRequest) (*genproto.WriteLogsResponse, error) {
+	if len(req.GetEntries()) > maxWriteBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d entries per batch, got %d", maxWriteBatch, len(req.GetEntries()))
+	}
+
+	entries := make([]*data.Entry, len(req.GetEntries()))
+	for i, input := range req.GetEntries() {
+		entries[i] = entryFromProto(input)
+	}
+
+	errs := l.repo.InsertMany(ctx, entries)
+
+	results := make([]*genproto.WriteResult, len(entries))
+	for i, err := range errs {
+		results[i] = &genproto.WriteResult{Id: entries[i].ID}
+		if err != nil && !(errors.Is(err, repository.ErrDuplicateEntry) && entries[i].EventID != "") {
+			s := status.Convert(grpcError(err))
+			results[i].Code = int32(s.Code())
+			results[i].Error = s.Message()
+		}
+	}
+
+	return &genproto.WriteLogsResponse{Results: results}, nil
+}
+
+// IngestLogs writes the streamed entries in batches. Invalid entries are skipped and counted, a
+// failing write ends the stream, what was written until then stays.
+func (l *LogServer) IngestLogs(stream grpc.ClientStreamingServer[genproto.Log, genproto.IngestLogsResponse]) error {
+	var res genproto.IngestLogsResponse
+	batch := make([]*data.Entry, 0, ingestBatch)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for i, err := range l.repo.InsertMany(stream.Context(), batch) {
+			switch {
+			case err == nil:
+				res.Written++
+			case errors.Is(err, repository.ErrDuplicateEntry) && batch[i].EventID != "":
+				res.Duplicates++
+			case errors.Is(err, repository.ErrInvalidData), errors.Is(err, repository.ErrDuplicateEntry):
+				res.Rejected++
+			default:
+				return status.Errorf(status.Code(grpcError(err)), "%v, %d entries written so far", err, res.Written)
+			}
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		input, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, entryFromProto(input))
+		if len(batch) == ingestBatch {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(&res)
+}
+
+func (l *LogServer) GetLog(ctx context.Context, req *genproto.GetLogRequest) (*genproto.Entry, error) {
+	entry, err := l.repo.Get(ctx, req.GetId())
 	if err != nil {
-		switch {
-		case errors.Is(err, repository.ErrDuplicateEntry):
-			msg = repository.ErrDuplicateEntry.Error()
-		case errors.Is(err, repository.ErrInvalidData):
-			msg = repository.ErrInvalidData.Error()
-		case errors.Is(err, repository.ErrDatabaseTimeout):
-			msg = repository.ErrDatabaseTimeout.Error()
-		default:
-			msg = "Something went wrong"
+		return nil, grpcError(err)
+	}
+
+	return entryToProto(entry)
+}
+
+// maxListLimit is how many entries one ListLogs call streams at most, more takes another call
+// resuming from the cursor of the last entry.
+const maxListLimit = 10_000
+
+// ListLogs streams the matching entries a page at a time, until the limit or the last one.
+func (l *LogServer) ListLogs(req *genproto.ListLogsRequest, stream grpc.ServerStreamingServer[genproto.ListLogsResponse]) error {
+	if req.GetLimit() < 0 {
+		return status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+
+	limit := int(req.GetLimit())
+	if limit == 0 || limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	filter := filterFromProto(req)
+	page := repository.Page{
+		Cursor:    req.GetCursor(),
+		Ascending: req.GetAscending(),
+	}
+
+	left := limit
+	for {
+		page.Limit = min(left, maxPageSize)
+
+		entries, next, err := l.repo.Find(stream.Context(), filter, page)
+		if err != nil {
+			return grpcError(err)
+		}
+
+		for _, entry := range entries {
+			e, err := entryToProto(&entry)
+			if err != nil {
+				return err
+			}
+
+			if err = stream.Send(&genproto.ListLogsResponse{
+				Entry:  e,
+				Cursor: repository.CursorAfter(entry, page.Ascending),
+			}); err != nil {
+				return err
+			}
+		}
+
+		left -= len(entries)
+		if next == "" || left <= 0 {
+			return nil
+		}
+
+		page.Cursor = next
+	}
+}
+
+// TailLogs streams the entries matching the filters as they're written. A client too slow to keep
+// up misses entries, the next one it gets says how many.
+func (l *LogServer) TailLogs(req *genproto.TailLogsRequest, stream grpc.ServerStreamingServer[genproto.TailLogsResponse]) error {
+	tail := l.repo.Tail(filterFromProto(req))
+	defer tail.Close()
+
+	var reported uint64
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case entry, ok := <-tail.Entries():
+			if !ok {
+				return status.Error(codes.Unavailable, "the logger is shutting down")
+			}
+
+			e, err := entryToProto(&entry)
+			if err != nil {
+				return err
+			}
+
+			dropped := tail.Dropped()
+			if err = stream.Send(&genproto.TailLogsResponse{
+				Entry:   e,
+				Dropped: dropped - reported,
+			}); err != nil {
+				return err
+			}
+			reported = dropped
+		}
+	}
+}
+
+// protoFilter is what ListLogsRequest and TailLogsRequest have in common.
+type protoFilter interface {
+	GetFrom() *timestamppb.Timestamp
+	GetTo() *timestamppb.Timestamp
+	GetTitle() string
+	GetSeverity() []genproto.Severity
+	GetService() string
+	GetSearch() string
+}
+
+func filterFromProto(req protoFilter) repository.Filter {
+	filter := repository.Filter{
+		Title:   req.GetTitle(),
+		Service: req.GetService(),
+		Search:  req.GetSearch(),
+	}
+	if req.GetFrom() != nil {
+		filter.From = req.GetFrom().AsTime()
+	}
+	if req.GetTo() != nil {
+		filter.To = req.GetTo().AsTime()
+	}
+	for _, severity := range req.GetSeverity() {
+		filter.Severity = append(filter.Severity, severityFromProto(severity))
+	}
+
+	return filter
+}
+
+// grpcError turns a repository error into a status with the matching code.
+func grpcError(err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, repository.ErrInvalidData),
+		errors.Is(err, repository.ErrInvalidID),
+		errors.Is(err, repository.ErrInvalidCursor):
+		code = codes.InvalidArgument
+	case errors.Is(err, repository.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, repository.ErrDuplicateEntry):
+		code = codes.AlreadyExists
+	case errors.Is(err, repository.ErrNotModified):
+		code = codes.FailedPrecondition
+	case errors.Is(err, repository.ErrEditConflict):
+		code = codes.Aborted
+	case errors.Is(err, repository.ErrDatabaseTimeout), errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	default:
+		// don't hand out the details of what broke
+		return status.Error(codes.Internal, "something went wrong")
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// entryFromProto turns the log of a request into an entry, the severity without its SEVERITY_ prefix.
+func entryFromProto(l *genproto.Log) *data.Entry {
+	entry := &data.Entry{
+		EventID:       l.GetEventId(),
+		Title:         l.GetName(),
+		Content:       l.GetData(),
+		Service:       l.GetService(),
+		TraceID:       l.GetTraceId(),
+		CorrelationID: l.GetCorrelationId(),
+		Tags:          l.GetTags(),
+		CreatedAt:     time.Now(),
+	}
+
+	if l.GetSeverity() != genproto.Severity_SEVERITY_UNSPECIFIED {
+		entry.Severity = severityFromProto(l.GetSeverity())
+	}
+
+	if l.GetAttributes() != nil {
+		entry.Attributes = l.GetAttributes().AsMap()
+	}
+
+	return entry
+}
+
+func entryToProto(entry *data.Entry) (*genproto.Entry, error) {
+	log := &genproto.Log{
+		Name:          entry.Title,
+		Data:          entry.Content,
+		Severity:      genproto.Severity(genproto.Severity_value["SEVERITY_"+entry.Severity]),
+		Service:       entry.Service,
+		TraceId:       entry.TraceID,
+		CorrelationId: entry.CorrelationID,
+		Tags:          entry.Tags,
+		EventId:       entry.EventID,
+	}
+
+	if len(entry.Attributes) > 0 {
+		// through json, mongo hands back its own types for arrays and numbers that structpb doesn't know
+		b, err := json.Marshal(entry.Attributes)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "encoding attributes: %v", err)
+		}
+
+		log.Attributes = &structpb.Struct{}
+		if err = protojson.Unmarshal(b, log.Attributes); err != nil {
+			return nil, status.Errorf(codes.Internal, "encoding attributes: %v", err)
 		}
-	} else {
-		msg = fmt.Sprintf("%s is successfully Logged!", input.Name)
 	}
 
-	// weird error handling...
+	return &genproto.Entry{
+		Id:        entry.ID,
+		Log:       log,
+		CreatedAt: timestamppb.New(entry.CreatedAt),
+		UpdatedAt: timestamppb.New(entry.UpdatedAt),
+	}, nil
+}
+
+func severityFromProto(s genproto.Severity) string {
+	return strings.TrimPrefix(s.String(), "SEVERITY_")
+}
 
-	return &genproto.LogResponse{Response: msg}, err
+// adminMethods hand entries back, the audit events of authentication among them, so they take
+// the admin token, as "authorization: Bearer <token>" metadata.
+var adminMethods = map[string]bool{
+	genproto.LogService_GetLog_FullMethodName:   true,
+	genproto.LogService_ListLogs_FullMethodName: true,
+	genproto.LogService_TailLogs_FullMethodName: true,
+}
+
+func (app *application) adminUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if adminMethods[info.FullMethod] {
+		if err := app.grpcAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+func (app *application) adminStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if adminMethods[info.FullMethod] {
+		if err := app.grpcAdmin(ss.Context()); err != nil {
+			return err
+		}
+	}
+
+	return handler(srv, ss)
+}
+
+// grpcAdmin is requireAdmin for gRPC calls.
+func (app *application) grpcAdmin(ctx context.Context) error {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+
+	switch err := app.checkAdmin(authorization); {
+	case err == nil:
+		return nil
+	case errors.Is(err, errAdminRequired):
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
 }
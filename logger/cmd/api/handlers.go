@@ -4,16 +4,33 @@ import (
 	"github.com/ziliscite/go-micro-logger/internal/data"
 	"github.com/ziliscite/go-micro-logger/internal/repository"
 
+	"github.com/go-chi/chi/v5"
+
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 func (app *application) writeLog(w http.ResponseWriter, r *http.Request) {
 	var request struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
+		// EventID is set when the entry is written for an event, see data.Entry
+		EventID  string `json:"event_id,omitempty"`
+		Title    string `json:"title"`
+		Content  string `json:"content"`
+		Severity string `json:"severity,omitempty"`
+
+		Service       string         `json:"service,omitempty"`
+		TraceID       string         `json:"trace_id,omitempty"`
+		CorrelationID string         `json:"correlation_id,omitempty"`
+		Tags          []string       `json:"tags,omitempty"`
+		Attributes    map[string]any `json:"attributes,omitempty"`
 	}
 
 	err := app.readBody(w, r, &request)
@@ -23,9 +40,16 @@ func (app *application) writeLog(w http.ResponseWriter, r *http.Request) {
 	}
 
 	entry := data.Entry{
-		Title:     request.Title,
-		Content:   request.Content,
-		CreatedAt: time.Now(),
+		EventID:       request.EventID,
+		Title:         request.Title,
+		Content:       request.Content,
+		Severity:      request.Severity,
+		Service:       request.Service,
+		TraceID:       request.TraceID,
+		CorrelationID: request.CorrelationID,
+		Tags:          request.Tags,
+		Attributes:    request.Attributes,
+		CreatedAt:     time.Now(),
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
@@ -34,14 +58,16 @@ func (app *application) writeLog(w http.ResponseWriter, r *http.Request) {
 	err = app.repo.Insert(ctx, &entry)
 	if err != nil {
 		switch {
-		case errors.Is(err, repository.ErrDuplicateEntry):
-			app.error(w, http.StatusConflict, err)
-		case errors.Is(err, repository.ErrInvalidData):
-			app.error(w, http.StatusBadRequest, err)
-		case errors.Is(err, repository.ErrDatabaseTimeout):
-			app.error(w, http.StatusGatewayTimeout, err)
+		case errors.Is(err, repository.ErrDuplicateEntry) && entry.EventID != "":
+			// the event was delivered again, it's logged already
+			if err = app.write(w, http.StatusOK, response{
+				Error:   false,
+				Message: "Log Already Inserted",
+			}); err != nil {
+				app.serverError(w, err)
+			}
 		default:
-			app.serverError(w, err)
+			app.repositoryError(w, err)
 		}
 		return
 	}
@@ -55,27 +81,251 @@ func (app *application) writeLog(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Page sizes for listLogs, when none is asked for and at most
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// listLogs serves a page of entries, newest first unless sort=asc. Filters are from and to
+// (RFC 3339), title, severity (comma separated), service and q, a full text search. The next
+// page is asked for with the cursor of the previous one.
 func (app *application) listLogs(w http.ResponseWriter, r *http.Request) {
+	filter, page, err := readLogQuery(r.URL.Query())
+	if err != nil {
+		app.error(w, http.StatusBadRequest, err)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	entries, err := app.repo.GetAll(ctx)
+	entries, next, err := app.repo.Find(ctx, filter, page)
 	if err != nil {
-		switch {
-		case errors.Is(err, repository.ErrNotFound):
-			app.error(w, http.StatusNotFound, err)
-		case errors.Is(err, repository.ErrInvalidID):
-			app.error(w, http.StatusBadRequest, err)
-		default:
-			app.serverError(w, err)
-		}
+		app.repositoryError(w, err)
 		return
 	}
 
 	if err = app.write(w, http.StatusOK, response{
 		Error:   false,
 		Message: "Logs Fetched",
-		Data:    entries,
+		Data: struct {
+			Entries    []data.Entry `json:"entries"`
+			NextCursor string       `json:"next_cursor,omitempty"`
+		}{entries, next},
+	}); err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// streamHeartbeat is how often streamLogs writes to an idle stream, so proxies don't cut it
+const streamHeartbeat = 15 * time.Second
+
+// streamLogs follows the entries as they're written, as server-sent "log" events carrying the
+// entry. It takes the filters of listLogs. A client too slow to keep up misses entries, a
+// "dropped" event with how many comes before the next one it gets.
+func (app *application) streamLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := readLogFilter(r.URL.Query())
+	if err != nil {
+		app.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tail := app.repo.Tail(filter)
+	defer tail.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx buffers responses by default, which holds the events back
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	var reported uint64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case entry, ok := <-tail.Entries():
+			if !ok {
+				// shutting down, the client reconnects to another instance or when we're back
+				return
+			}
+
+			if dropped := tail.Dropped(); dropped > reported {
+				if _, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped-reported); err != nil {
+					return
+				}
+				reported = dropped
+			}
+
+			var b []byte
+			if b, err = json.Marshal(entry); err != nil {
+				// the stream is already going, skip the entry rather than end it
+				slog.Error("Failed to encode streamed entry", "id", entry.ID, "error", err)
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "id: %s\nevent: log\ndata: %s\n\n", entry.ID, b)
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func readLogQuery(qs url.Values) (repository.Filter, repository.Page, error) {
+	page := repository.Page{
+		Limit:  defaultPageSize,
+		Cursor: qs.Get("cursor"),
+	}
+
+	filter, err := readLogFilter(qs)
+	if err != nil {
+		return filter, page, err
+	}
+
+	if v := qs.Get("limit"); v != "" {
+		page.Limit, err = strconv.Atoi(v)
+		if err != nil || page.Limit < 1 || page.Limit > maxPageSize {
+			return filter, page, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+
+	switch strings.ToLower(qs.Get("sort")) {
+	case "", "desc":
+	case "asc":
+		page.Ascending = true
+	default:
+		return filter, page, errors.New("sort must be asc or desc")
+	}
+
+	return filter, page, nil
+}
+
+// readLogFilter reads the filters listLogs, streamLogs and deleteLogs share.
+func readLogFilter(qs url.Values) (repository.Filter, error) {
+	var filter repository.Filter
+
+	var err error
+	if v := qs.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("from must be an RFC 3339 time: %w", err)
+		}
+	}
+	if v := qs.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("to must be an RFC 3339 time: %w", err)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	filter.Title = qs.Get("title")
+	filter.Service = qs.Get("service")
+	filter.Search = qs.Get("q")
+
+	if v := qs.Get("severity"); v != "" {
+		for _, severity := range strings.Split(v, ",") {
+			filter.Severity = append(filter.Severity, strings.ToUpper(strings.TrimSpace(severity)))
+		}
+	}
+
+	return filter, nil
+}
+
+func (app *application) getLog(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	entry, err := app.repo.Get(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		app.repositoryError(w, err)
+		return
+	}
+
+	if err = app.write(w, http.StatusOK, response{
+		Error:   false,
+		Message: "Log Fetched",
+		Data:    entry,
+	}); err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// updateLog applies a partial update, only the fields in the body change. A patch that changes
+// nothing gets a 304, one racing another update a 409.
+func (app *application) updateLog(w http.ResponseWriter, r *http.Request) {
+	var patch data.EntryPatch
+
+	err := app.readBody(w, r, &patch)
+	if err != nil {
+		app.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	entry, err := app.repo.Update(ctx, chi.URLParam(r, "id"), patch)
+	if err != nil {
+		app.repositoryError(w, err)
+		return
+	}
+
+	if err = app.write(w, http.StatusOK, response{
+		Error:   false,
+		Message: "Log Updated",
+		Data:    entry,
+	}); err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// deleteLogs deletes every entry matching the same filters as listLogs. Deleting everything
+// has to be asked for with all=true, so a forgotten filter doesn't wipe the logs.
+func (app *application) deleteLogs(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	filter, err := readLogFilter(qs)
+	if err != nil {
+		app.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.Empty() && qs.Get("all") != "true" {
+		app.error(w, http.StatusBadRequest, errors.New("a filter is required, or all=true to delete every entry"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	deleted, err := app.repo.Delete(ctx, filter)
+	if err != nil {
+		app.repositoryError(w, err)
+		return
+	}
+
+	if err = app.write(w, http.StatusOK, response{
+		Error:   false,
+		Message: "Logs Deleted",
+		Data:    map[string]int64{"deleted": deleted},
 	}); err != nil {
 		app.serverError(w, err)
 	}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"github.com/ziliscite/go-micro-logger/internal/repository"
+
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -63,6 +65,27 @@ func (app *application) serverError(w http.ResponseWriter, err error) {
 	app.error(w, http.StatusInternalServerError, errors.New(message))
 }
 
+// repositoryError answers with the status matching one of the repository's errors.
+func (app *application) repositoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotModified):
+		// nothing to send back, the entry is as it was
+		w.WriteHeader(http.StatusNotModified)
+	case errors.Is(err, repository.ErrNotFound):
+		app.error(w, http.StatusNotFound, err)
+	case errors.Is(err, repository.ErrInvalidID),
+		errors.Is(err, repository.ErrInvalidData),
+		errors.Is(err, repository.ErrInvalidCursor):
+		app.error(w, http.StatusBadRequest, err)
+	case errors.Is(err, repository.ErrDuplicateEntry), errors.Is(err, repository.ErrEditConflict):
+		app.error(w, http.StatusConflict, err)
+	case errors.Is(err, repository.ErrDatabaseTimeout):
+		app.error(w, http.StatusGatewayTimeout, err)
+	default:
+		app.serverError(w, err)
+	}
+}
+
 func (app *application) readBody(w http.ResponseWriter, r *http.Request, dst any) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
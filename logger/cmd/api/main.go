@@ -1,12 +1,11 @@
 package main
 
 import (
-	"fmt"
+	"github.com/ziliscite/go-micro-logger/internal/config"
 	"github.com/ziliscite/go-micro-logger/internal/repository"
-	genproto "github.com/ziliscite/go-micro-logger/proto/genproto"
-	"google.golang.org/grpc"
-	"net"
 	"net/rpc"
+	"os/signal"
+	"syscall"
 
 	"context"
 	"log/slog"
@@ -18,36 +17,51 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const (
-	ApiPort  = "80"
-	RPCPort  = "5001"
-	GRPCPort = "50001"
-)
-
 type application struct {
+	cfg  config.Config
 	repo *repository.Repository
 }
 
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	var cfg config.Config
+	if err := config.Load(&cfg, os.Args[1:]); err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Loaded configuration", "config", config.Redacted(cfg))
+
+	// Stop on ctrl-c and on docker's SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	client, err := openMongo(ctx)
+	client, err := openMongo(connectCtx, cfg)
 	if err != nil {
 		slog.Error("Failed to connect to mongo", "error", err)
 		os.Exit(1)
 	}
 	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := client.Disconnect(ctx); err != nil {
 			slog.Error("Failed to disconnect from mongo", "error", err)
-			os.Exit(1)
 		}
 	}()
 
 	app := application{
+		cfg:  cfg,
 		repo: repository.New(client),
 	}
 
+	if err = app.repo.EnsureIndexes(connectCtx); err != nil {
+		slog.Error("Failed to create indexes", "error", err)
+		os.Exit(1)
+	}
+
 	// Register rpc -- must be a pointer
 	if err = rpc.Register(&RPCServer{
 		repo: app.repo,
@@ -56,64 +70,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	go app.rpcListen()
-
-	go app.grpcListen()
-
-	if err = app.serve(); err != nil {
-		slog.Error("Failed to start server", "error", err)
+	// Calls in flight on every server are drained before the deferred mongo client disconnects
+	if err = app.serve(ctx); err != nil {
+		slog.Error("Server stopped with an error", "error", err)
 		os.Exit(1)
 	}
-}
 
-func (app *application) rpcListen() {
-	slog.Info("Starting rpc server", "port", RPCPort)
-
-	listen, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", RPCPort))
-	if err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
-	}
-	defer listen.Close()
-
-	for {
-		conn, err := listen.Accept()
-		if err != nil {
-			continue
-		}
-		go rpc.ServeConn(conn)
-	}
+	slog.Info("Logger service stopped")
 }
 
-func (app *application) grpcListen() {
-	listen, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", GRPCPort))
-	if err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
-	}
-	defer listen.Close()
-
-	srv := grpc.NewServer()
-
-	// Register the service
-	genproto.RegisterLogServiceServer(srv, &LogServer{
-		repo: app.repo,
-	})
-
-	slog.Info("Starting grpc server", "port", GRPCPort)
-
-	if err = srv.Serve(listen); err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
-	}
-}
-
-func openMongo(ctx context.Context) (*mongo.Client, error) {
+func openMongo(ctx context.Context, cfg config.Config) (*mongo.Client, error) {
 	// Use the SetServerAPIOptions() method to set the version of the Stable API on the client
-	opts := options.Client().ApplyURI(os.Getenv("MONGO_URL"))
+	opts := options.Client().ApplyURI(cfg.Mongo.URL)
+
+	// nested attributes come back as maps, not as the key/value pairs of bson.D
+	opts.SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})
 	opts.SetAuth(options.Credential{
-		Username: os.Getenv("MONGO_USERNAME"),
-		Password: os.Getenv("MONGO_PASSWORD"),
+		Username: cfg.Mongo.Username,
+		Password: cfg.Mongo.Password,
 	})
 
 	// Create a new client and connect to the server
@@ -123,7 +97,7 @@ func openMongo(ctx context.Context) (*mongo.Client, error) {
 	}
 
 	// Send a ping to confirm a successful connection
-	if err = client.Database(os.Getenv("MONGO_DATABASE")).RunCommand(ctx, bson.D{{"ping", 1}}).Err(); err != nil {
+	if err = client.Database(cfg.Mongo.Database).RunCommand(ctx, bson.D{{"ping", 1}}).Err(); err != nil {
 		return nil, err
 	}
 
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"fmt"
-	"log/slog"
+	"crypto/subtle"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -17,7 +18,7 @@ func (app *application) routes() http.Handler {
 	mux.Use(
 		cors.Handler(cors.Options{
 			AllowedOrigins:   []string{"https://*", "http://*"},
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 			ExposedHeaders:   []string{"Link"},
 			AllowCredentials: true,
@@ -29,17 +30,55 @@ func (app *application) routes() http.Handler {
 	mux.Route("/v1", func(v1 chi.Router) {
 		v1.Post("/logs", app.writeLog)
 		v1.Get("/logs", app.listLogs)
+		v1.Get("/logs/{id}", app.getLog)
+
+		// entries are the record of what happened, only admins get to rewrite or remove them
+		v1.With(app.requireAdmin).Patch("/logs/{id}", app.updateLog)
+		v1.With(app.requireAdmin).Delete("/logs", app.deleteLogs)
+
+		// the stream carries the audit events too, users follow it through the broker
+		v1.With(app.requireAdmin).Get("/logs/stream", app.streamLogs)
 	})
 
 	return middleware.Recoverer(mux)
 }
 
-func (app *application) serve() error {
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", ApiPort),
-		Handler: app.routes(),
+// Why checkAdmin refused a token
+var (
+	errAdminDisabled = errors.New("admin endpoints are disabled, ADMIN_TOKEN is not set")
+	errAdminRequired = errors.New("admin token required")
+	errAdminInvalid  = errors.New("invalid admin token")
+)
+
+// checkAdmin tells whether the Authorization value carries the admin token as a bearer token.
+func (app *application) checkAdmin(authorization string) error {
+	if app.cfg.AdminToken == "" {
+		return errAdminDisabled
+	}
+
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return errAdminRequired
 	}
 
-	slog.Info("Starting logger service", "port", ApiPort)
-	return server.ListenAndServe()
+	if subtle.ConstantTimeCompare([]byte(token), []byte(app.cfg.AdminToken)) != 1 {
+		return errAdminInvalid
+	}
+
+	return nil
+}
+
+// requireAdmin lets through requests carrying the admin token as a bearer token.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch err := app.checkAdmin(r.Header.Get("Authorization")); {
+		case err == nil:
+			next.ServeHTTP(w, r)
+		case errors.Is(err, errAdminRequired):
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.error(w, http.StatusUnauthorized, err)
+		default:
+			app.error(w, http.StatusForbidden, err)
+		}
+	})
 }
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/ziliscite/go-micro-logger/internal/data"
 	"github.com/ziliscite/go-micro-logger/internal/repository"
 	"log/slog"
@@ -14,9 +17,21 @@ type RPCServer struct {
 }
 
 // RPCPayload is the payload we're going to receive from the rpc
+//
+// It's gob encoded, fields are matched by name, so the caller's type has to use the same names
 type RPCPayload struct {
-	Name string `json:"name"`
-	Data string `json:"data"`
+	Name     string `json:"name"`
+	Data     string `json:"data"`
+	Severity string `json:"severity"`
+
+	Service       string `json:"service"`
+	TraceID       string `json:"trace_id"`
+	CorrelationID string `json:"correlation_id"`
+	EventID       string `json:"event_id"`
+
+	Tags []string `json:"tags"`
+	// Attributes is a json object, gob can't carry arbitrary values
+	Attributes json.RawMessage `json:"attributes"`
 }
 
 // LogInfo log data and write it to mongo
@@ -28,11 +43,31 @@ func (r *RPCServer) LogInfo(payload RPCPayload, res *string) error {
 	defer cancel()
 
 	entry := data.Entry{
-		Title:     payload.Name,
-		Content:   payload.Data,
-		CreatedAt: time.Now(),
+		EventID:       payload.EventID,
+		Title:         payload.Name,
+		Content:       payload.Data,
+		Severity:      payload.Severity,
+		Service:       payload.Service,
+		TraceID:       payload.TraceID,
+		CorrelationID: payload.CorrelationID,
+		Tags:          payload.Tags,
+		CreatedAt:     time.Now(),
+	}
+
+	if len(payload.Attributes) > 0 {
+		if err := json.Unmarshal(payload.Attributes, &entry.Attributes); err != nil {
+			*res = "Invalid attributes: " + err.Error()
+			return fmt.Errorf("%w: attributes must be a json object: %v", repository.ErrInvalidData, err)
+		}
 	}
+
 	err := r.repo.Insert(ctx, &entry)
+	if errors.Is(err, repository.ErrDuplicateEntry) && entry.EventID != "" {
+		// the event was delivered again, it's logged already
+		*res = "Already processed entry: " + entry.Title
+		return nil
+	}
+
 	if err != nil {
 		slog.Error("Failed to insert data", "error", err)
 		*res = "Failed to insert data: " + err.Error()
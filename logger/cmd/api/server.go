@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	genproto "github.com/ziliscite/go-micro-logger/proto/genproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// serve runs the http, rpc and grpc servers until ctx is done or one of them fails, then stops
+// all of them from accepting and waits for in-flight calls, for at most the shutdown timeout.
+func (app *application) serve(ctx context.Context) error {
+	rpcListener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", app.cfg.RPCPort))
+	if err != nil {
+		return err
+	}
+
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", app.cfg.GRPCPort))
+	if err != nil {
+		rpcListener.Close()
+		return err
+	}
+
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%s", app.cfg.Port),
+		Handler: app.routes(),
+	}
+
+	// the broker keeps a long-lived connection with keepalive pings, allow them
+	grpcServer := grpc.NewServer(
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             15 * time.Second,
+			PermitWithoutStream: true,
+		}),
+		// reading entries back takes the admin token, writing them doesn't
+		grpc.UnaryInterceptor(app.adminUnary),
+		grpc.StreamInterceptor(app.adminStream),
+	)
+
+	// Register the service
+	genproto.RegisterLogServiceServer(grpcServer, &LogServer{
+		repo: app.repo,
+	})
+
+	rpcServer := newRPCServer()
+
+	errs := make(chan error, 3)
+	go func() {
+		slog.Info("Starting rpc server", "port", app.cfg.RPCPort)
+		errs <- rpcServer.Serve(rpcListener)
+	}()
+
+	go func() {
+		slog.Info("Starting grpc server", "port", app.cfg.GRPCPort)
+		errs <- grpcServer.Serve(grpcListener)
+	}()
+
+	go func() {
+		slog.Info("Starting logger service", "port", app.cfg.Port)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	var failure error
+	select {
+	case failure = <-errs:
+		slog.Error("Server failed, shutting down the others", "error", failure)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down logger service", "timeout", app.cfg.ShutdownTimeout)
+
+	// streamed tails only end when the client leaves, end them so the servers can drain
+	app.repo.StopTails()
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.cfg.ShutdownTimeout)
+	defer cancel()
+
+	// the three drain at the same time, sharing the deadline
+	var wg sync.WaitGroup
+	shutdownErrs := make([]error, 3)
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			shutdownErrs[0] = fmt.Errorf("draining http: %w", err)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		if err := rpcServer.Shutdown(ctx); err != nil {
+			shutdownErrs[1] = fmt.Errorf("draining rpc: %w", err)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		if err := stopGRPC(ctx, grpcServer); err != nil {
+			shutdownErrs[2] = fmt.Errorf("draining grpc: %w", err)
+		}
+	}()
+
+	wg.Wait()
+
+	return errors.Join(append(shutdownErrs, failure)...)
+}
+
+// stopGRPC lets in-flight calls finish, cutting them off if ctx is done first.
+func stopGRPC(ctx context.Context, srv *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// rpcServer serves net/rpc over raw tcp, keeping track of connections so they can be drained.
+//
+// net/rpc has no shutdown of its own. Closing the read side of a connection makes ServeConn
+// stop reading new calls, wait for the ones in flight and write their replies, then return.
+type rpcServer struct {
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+
+	// connections still being served
+	wg sync.WaitGroup
+}
+
+func newRPCServer() *rpcServer {
+	return &rpcServer{
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections until Shutdown is called, serving the rpc.Register'ed services.
+// Temporary accept errors, like running out of file descriptors, are retried with a backoff the
+// way net/http does, any other one is returned.
+func (s *rpcServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				delay = min(max(delay*2, 5*time.Millisecond), time.Second)
+
+				slog.Error("Failed to accept rpc connection, retrying", "delay", delay, "error", err)
+				time.Sleep(delay)
+				continue
+			}
+
+			return err
+		}
+		delay = 0
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+
+		go func() {
+			defer s.untrack(conn)
+			rpc.ServeConn(conn)
+		}()
+	}
+}
+
+func (s *rpcServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *rpcServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	s.wg.Done()
+}
+
+// Shutdown stops accepting connections and waits for in-flight calls to be answered. Connections
+// still open when ctx is done are closed.
+func (s *rpcServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	for conn := range s.conns {
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.CloseRead()
+			continue
+		}
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+
+		return ctx.Err()
+	}
+}
@@ -8,6 +8,7 @@ require (
 	go.mongodb.org/mongo-driver v1.17.2
 	google.golang.org/grpc v1.70.0
 	google.golang.org/protobuf v1.36.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
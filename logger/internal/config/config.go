@@ -0,0 +1,24 @@
+package config
+
+import "time"
+
+// Config is everything the logger needs to run. See Load for where the values come from.
+type Config struct {
+	Port     string `yaml:"port" env:"PORT" flag:"port" default:"80"`
+	RPCPort  string `yaml:"rpc_port" env:"RPC_PORT" flag:"rpc-port" default:"5001"`
+	GRPCPort string `yaml:"grpc_port" env:"GRPC_PORT" flag:"grpc-port" default:"50001"`
+
+	// ShutdownTimeout is how long in-flight work gets to finish once we're told to stop,
+	// docker kills the container 10s after SIGTERM by default
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" default:"8s"`
+
+	// AdminToken guards the admin endpoints, sent as a bearer token. They're off when it's empty.
+	AdminToken string `yaml:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+
+	Mongo struct {
+		URL      string `yaml:"url" env:"MONGO_URL" flag:"mongo-url" required:"true"`
+		Username string `yaml:"username" env:"MONGO_USERNAME"`
+		Password string `yaml:"password" env:"MONGO_PASSWORD" secret:"true"`
+		Database string `yaml:"database" env:"MONGO_DATABASE" required:"true"`
+	} `yaml:"mongo"`
+}
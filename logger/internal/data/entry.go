@@ -1,11 +1,109 @@
 package data
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Severities an entry can have, from the least to the most severe
+const (
+	SeverityDebug = "DEBUG"
+	SeverityInfo  = "INFO"
+	SeverityWarn  = "WARN"
+	SeverityError = "ERROR"
+)
+
+var severities = []string{SeverityDebug, SeverityInfo, SeverityWarn, SeverityError}
 
 type Entry struct {
-	ID        string    `bson:"_id,omitempty" json:"id"`
-	Title     string    `bson:"title" json:"title"`
-	Content   string    `bson:"content" json:"content"`
+	ID string `bson:"_id,omitempty" json:"id"`
+	// EventID is the ID of the event the entry was written for, at most one entry per event
+	EventID  string `bson:"event_id,omitempty" json:"event_id,omitempty"`
+	Title    string `bson:"title" json:"title"`
+	Content  string `bson:"content" json:"content"`
+	Severity string `bson:"severity,omitempty" json:"severity,omitempty"` // see the Severity constants
+
+	// Service is who wrote the entry
+	Service string `bson:"service,omitempty" json:"service,omitempty"`
+	// TraceID and CorrelationID tie the entry to the trace and the request it came from
+	TraceID       string `bson:"trace_id,omitempty" json:"trace_id,omitempty"`
+	CorrelationID string `bson:"correlation_id,omitempty" json:"correlation_id,omitempty"`
+
+	// Tags are free-form labels to find entries by, like "audit" or "billing"
+	Tags []string `bson:"tags,omitempty" json:"tags,omitempty"`
+	// Attributes is whatever structured data goes with the entry
+	Attributes map[string]any `bson:"attributes,omitempty" json:"attributes,omitempty"`
+
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }
+
+// Normalize upper-cases the severity, INFO when there's none, and trims the tags, dropping
+// empty and repeated ones.
+func (e *Entry) Normalize() {
+	e.Severity = strings.ToUpper(strings.TrimSpace(e.Severity))
+	if e.Severity == "" {
+		e.Severity = SeverityInfo
+	}
+
+	tags := e.Tags[:0]
+	for _, tag := range e.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	e.Tags = tags
+}
+
+// Validate checks a normalized entry.
+func (e *Entry) Validate() error {
+	if e.Title == "" {
+		return errors.New("title must be provided")
+	}
+
+	if !slices.Contains(severities, e.Severity) {
+		return fmt.Errorf("unknown severity %q, want one of %s", e.Severity, strings.Join(severities, ", "))
+	}
+
+	return nil
+}
+
+// EntryPatch is a partial update of an entry, nil fields are left as they are.
+type EntryPatch struct {
+	Title      *string        `json:"title,omitempty"`
+	Content    *string        `json:"content,omitempty"`
+	Severity   *string        `json:"severity,omitempty"`
+	Tags       []string       `json:"tags,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Empty tells whether the patch changes nothing at all.
+func (p EntryPatch) Empty() bool {
+	return p.Title == nil && p.Content == nil && p.Severity == nil && p.Tags == nil && p.Attributes == nil
+}
+
+// Apply returns a copy of e with the patch applied, normalized.
+func (p EntryPatch) Apply(e Entry) Entry {
+	if p.Title != nil {
+		e.Title = *p.Title
+	}
+	if p.Content != nil {
+		e.Content = *p.Content
+	}
+	if p.Severity != nil {
+		e.Severity = *p.Severity
+	}
+	if p.Tags != nil {
+		e.Tags = slices.Clone(p.Tags)
+	}
+	if p.Attributes != nil {
+		e.Attributes = p.Attributes
+	}
+
+	e.Normalize()
+	return e
+}
@@ -3,10 +3,12 @@ package repository
 import (
 	"github.com/ziliscite/go-micro-logger/internal/data"
 
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log/slog"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -23,11 +25,15 @@ var (
 	ErrNotFound  = errors.New("entry not found")
 	ErrInvalidID = errors.New("invalid ID format")
 
-	ErrNotModified = errors.New("entry not modified")
+	ErrNotModified  = errors.New("entry not modified")
+	ErrEditConflict = errors.New("entry was changed by someone else, try again")
 )
 
 type Repository struct {
 	mc *mongo.Collection
+
+	// the tails following what's written
+	tails *hub
 }
 
 func New(client *mongo.Client) *Repository {
@@ -36,14 +42,44 @@ func New(client *mongo.Client) *Repository {
 		//
 		// If a collection is not available, it will be created
 		mc: client.Database("logs").Collection("logs"),
+
+		tails: newHub(),
 	}
 }
 
+// EnsureIndexes creates the indexes the repository relies on, if they're missing.
+func (r Repository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.mc.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{"event_id", 1}},
+			// entries written without an event don't have one, they don't collide
+			Options: options.Index().SetName("event_id_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.D{{"event_id", bson.D{{"$exists", true}}}}),
+		},
+		// pages are sorted by created_at then _id, every filter ends with them so Find never sorts in memory
+		{Keys: bson.D{{"created_at", -1}, {"_id", -1}}},
+		{Keys: bson.D{{"severity", 1}, {"created_at", -1}, {"_id", -1}}},
+		{Keys: bson.D{{"service", 1}, {"created_at", -1}, {"_id", -1}}},
+		{Keys: bson.D{{"title", 1}, {"created_at", -1}, {"_id", -1}}},
+		// Filter.Search, there can only be one text index per collection
+		{Keys: bson.D{{"title", "text"}, {"content", "text"}}},
+	})
+	return err
+}
+
+// Insert normalizes and writes the entry, giving it its ID. An invalid entry fails with
+// ErrInvalidData, and an entry for an event that already has one with ErrDuplicateEntry.
 func (r Repository) Insert(ctx context.Context, entry *data.Entry) error {
+	entry.Normalize()
+	if err := entry.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+
 	// Insert a log entry
 	res, err := r.mc.InsertOne(ctx, entry)
 	if err == nil {
 		entry.ID = res.InsertedID.(primitive.ObjectID).Hex()
+		r.tails.publish(*entry)
 		return nil
 	}
 
@@ -51,56 +87,104 @@ func (r Repository) Insert(ctx context.Context, entry *data.Entry) error {
 	var writeErr mongo.WriteException
 	if errors.As(err, &writeErr) {
 		for _, e := range writeErr.WriteErrors {
-			switch e.Code {
-			case 11000: // Duplicate key error code
-				return fmt.Errorf("%w: %v", ErrDuplicateEntry, err)
-			case 121: // Document validation error
-				return fmt.Errorf("%w: %v", ErrInvalidData, err)
+			if mapped := writeError(e.Code, err); mapped != nil {
+				return mapped
 			}
 		}
 	}
 
-	// Context-related errors
-	if errors.Is(err, context.DeadlineExceeded) {
-		return fmt.Errorf("%w: %v", ErrDatabaseTimeout, err)
+	return databaseError(err)
+}
+
+// InsertMany normalizes and writes the entries in one go, giving each its ID. It returns one
+// error per entry, nil for the ones written, with the same meaning as Insert's.
+func (r Repository) InsertMany(ctx context.Context, entries []*data.Entry) []error {
+	errs := make([]error, len(entries))
+
+	// only the valid ones are sent, index maps them back to entries
+	var docs []any
+	var index []int
+	for i, entry := range entries {
+		entry.Normalize()
+		if err := entry.Validate(); err != nil {
+			errs[i] = fmt.Errorf("%w: %v", ErrInvalidData, err)
+			continue
+		}
+
+		docs = append(docs, entry)
+		index = append(index, i)
 	}
 
-	return fmt.Errorf("database error: %w", err)
-}
+	if len(docs) == 0 {
+		return errs
+	}
 
-func (r Repository) GetAll(ctx context.Context) ([]data.Entry, error) {
-	entries := make([]data.Entry, 0)
+	// unordered, so one bad entry doesn't stop the ones after it
+	res, err := r.mc.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
 
-	// Get all logs in the collection
-	cursor, err := r.mc.Find(ctx, bson.D{}, options.Find().SetSort(
-		// Sort by created_at in descending order
-		bson.D{{"created_at", -1}},
-	))
-	if err != nil {
-		return nil, fmt.Errorf("database query failed: %w", err)
+	var bulkErr mongo.BulkWriteException
+	switch {
+	case err == nil:
+	case errors.As(err, &bulkErr):
+		for _, e := range bulkErr.WriteErrors {
+			if e.Index < 0 || e.Index >= len(index) {
+				continue
+			}
+
+			errs[index[e.Index]] = writeError(e.Code, e)
+			if errs[index[e.Index]] == nil {
+				errs[index[e.Index]] = fmt.Errorf("database error: %w", e)
+			}
+		}
+	default:
+		// nothing is known to be written
+		err = databaseError(err)
+		for _, i := range index {
+			errs[i] = err
+		}
+		return errs
 	}
 
-	defer func() {
-		if err = cursor.Close(ctx); err != nil {
-			slog.Error("Failed to close cursor", "error", err)
+	for n, i := range index {
+		if errs[i] != nil || res == nil || n >= len(res.InsertedIDs) {
+			continue
 		}
-	}()
 
-	for cursor.Next(ctx) {
-		var entry data.Entry
-		if err = cursor.Decode(&entry); err != nil {
-			return nil, fmt.Errorf("data decoding error: %w", err)
+		if id, ok := res.InsertedIDs[n].(primitive.ObjectID); ok {
+			entries[i].ID = id.Hex()
 		}
+	}
+
+	written := make([]data.Entry, 0, len(index))
+	for _, i := range index {
+		if errs[i] == nil {
+			written = append(written, *entries[i])
+		}
+	}
+	r.tails.publish(written...)
+
+	return errs
+}
 
-		entries = append(entries, entry)
+// writeError maps the code of a mongo write error to one of ours, nil for the ones we don't know.
+func writeError(code int, err error) error {
+	switch code {
+	case 11000: // Duplicate key error code
+		return fmt.Errorf("%w: %v", ErrDuplicateEntry, err)
+	case 121: // Document validation error
+		return fmt.Errorf("%w: %v", ErrInvalidData, err)
+	default:
+		return nil
 	}
+}
 
-	// Check for errors
-	if err = cursor.Err(); err != nil {
-		return nil, fmt.Errorf("database iteration failed: %w", err)
+func databaseError(err error) error {
+	// Context-related errors
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrDatabaseTimeout, err)
 	}
 
-	return entries, nil
+	return fmt.Errorf("database error: %w", err)
 }
 
 func (r Repository) Get(ctx context.Context, id string) (*data.Entry, error) {
@@ -130,20 +214,43 @@ func (r Repository) Drop(ctx context.Context) error {
 	return r.mc.Drop(ctx)
 }
 
-func (r Repository) Update(ctx context.Context, entry *data.Entry) (*mongo.UpdateResult, error) {
-	// Parse the ID
-	entryId, err := primitive.ObjectIDFromHex(entry.ID)
+// Update applies the patch to the entry with the given ID, and returns the updated entry.
+//
+// It fails with ErrNotModified when the patch leaves the entry as it was, and with ErrEditConflict
+// when someone else updated the entry in the meantime.
+func (r Repository) Update(ctx context.Context, id string, patch data.EntryPatch) (*data.Entry, error) {
+	if patch.Empty() {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidData)
+	}
+
+	current, err := r.Get(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidID, err)
+		return nil, err
+	}
+
+	updated := patch.Apply(*current)
+	if err = updated.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+
+	if sameContent(*current, updated) {
+		return nil, fmt.Errorf("%w: id %s", ErrNotModified, id)
 	}
 
-	// Update a log entry
-	res, err := r.mc.UpdateByID(ctx, entryId, bson.D{
+	updated.UpdatedAt = time.Now()
+
+	entryId, _ := primitive.ObjectIDFromHex(id) // Get already checked it
+
+	// only if it's still the version we read
+	res, err := r.mc.UpdateOne(ctx, bson.D{{"_id", entryId}, {"updated_at", current.UpdatedAt}}, bson.D{
 		{"$set", bson.D{
 			// Set the new value for fields
-			{"title", entry.Title},
-			{"content", entry.Content},
-			{"updated_at", time.Now()},
+			{"title", updated.Title},
+			{"content", updated.Content},
+			{"severity", updated.Severity},
+			{"tags", updated.Tags},
+			{"attributes", updated.Attributes},
+			{"updated_at", updated.UpdatedAt},
 		}},
 	})
 	if err != nil {
@@ -156,16 +263,44 @@ func (r Repository) Update(ctx context.Context, entry *data.Entry) (*mongo.Updat
 				}
 			}
 		}
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %v", ErrDatabaseTimeout, err)
+		}
+
 		return nil, fmt.Errorf("database update failed: %w", err)
 	}
 
 	if res.MatchedCount == 0 {
-		return nil, fmt.Errorf("%w: id %s", ErrNotFound, entry.ID)
+		return nil, fmt.Errorf("%w: id %s", ErrEditConflict, id)
+	}
+
+	return &updated, nil
+}
+
+// sameContent tells whether two versions of an entry hold the same data. Attributes are compared
+// as json, numbers decoded from mongo and from a request have different types.
+func sameContent(a, b data.Entry) bool {
+	if a.Title != b.Title || a.Content != b.Content || a.Severity != b.Severity || !slices.Equal(a.Tags, b.Tags) {
+		return false
 	}
 
-	if res.ModifiedCount == 0 {
-		return nil, fmt.Errorf("%w: id %s", ErrNotModified, entry.ID)
+	aAttrs, errA := json.Marshal(a.Attributes)
+	bAttrs, errB := json.Marshal(b.Attributes)
+
+	return errA == nil && errB == nil && bytes.Equal(aAttrs, bAttrs)
+}
+
+// Delete deletes every entry matching f, and returns how many it deleted. An empty filter
+// deletes everything, the caller has to make sure that's what was asked for.
+func (r Repository) Delete(ctx context.Context, f Filter) (int64, error) {
+	res, err := r.mc.DeleteMany(ctx, f.query())
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return 0, fmt.Errorf("%w: %v", ErrDatabaseTimeout, err)
+		}
+		return 0, fmt.Errorf("database delete failed: %w", err)
 	}
 
-	return res, nil
+	return res.DeletedCount, nil
 }
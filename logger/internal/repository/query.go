@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"github.com/ziliscite/go-micro-logger/internal/data"
+
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Filter narrows down the entries Find returns. Zero values don't filter anything.
+type Filter struct {
+	// From and To bound created_at, From included and To excluded
+	From time.Time
+	To   time.Time
+
+	Title    string
+	Severity []string // any of them
+	Service  string
+
+	// Search is a full text search over the title and content
+	Search string
+}
+
+// Empty tells whether the filter matches every entry.
+func (f Filter) Empty() bool {
+	return f.From.IsZero() && f.To.IsZero() && f.Title == "" && len(f.Severity) == 0 && f.Service == "" && f.Search == ""
+}
+
+func (f Filter) query() bson.D {
+	filter := bson.D{}
+
+	if !f.From.IsZero() || !f.To.IsZero() {
+		createdAt := bson.D{}
+		if !f.From.IsZero() {
+			createdAt = append(createdAt, bson.E{"$gte", f.From})
+		}
+		if !f.To.IsZero() {
+			createdAt = append(createdAt, bson.E{"$lt", f.To})
+		}
+		filter = append(filter, bson.E{"created_at", createdAt})
+	}
+
+	if f.Title != "" {
+		filter = append(filter, bson.E{"title", f.Title})
+	}
+	if len(f.Severity) > 0 {
+		filter = append(filter, bson.E{"severity", bson.D{{"$in", f.Severity}}})
+	}
+	if f.Service != "" {
+		filter = append(filter, bson.E{"service", f.Service})
+	}
+	if f.Search != "" {
+		filter = append(filter, bson.E{"$text", bson.D{{"$search", f.Search}}})
+	}
+
+	return filter
+}
+
+// Page selects a page of Find results, in created_at order, ties broken by ID.
+type Page struct {
+	Limit int
+	// Cursor is the Next of the previous page, empty for the first one
+	Cursor string
+	// Ascending lists the oldest entries first, the newest come first by default
+	Ascending bool
+}
+
+// pageCursor is where a page stopped, the last entry it returned. It's handed out base64 encoded.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+	Ascending bool      `json:"asc"`
+}
+
+func (c pageCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	var c pageCursor
+	if err = json.Unmarshal(b, &c); err != nil {
+		return pageCursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	return c, nil
+}
+
+// Find returns a page of the entries matching f, and the cursor of the next page, empty when
+// this was the last one.
+func (r Repository) Find(ctx context.Context, f Filter, p Page) ([]data.Entry, string, error) {
+	filter := f.query()
+
+	// newest first unless asked otherwise
+	direction, compare := -1, "$lt"
+	if p.Ascending {
+		direction, compare = 1, "$gt"
+	}
+
+	if p.Cursor != "" {
+		c, err := decodeCursor(p.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if c.Ascending != p.Ascending {
+			return nil, "", fmt.Errorf("%w: it was made for the other sort direction", ErrInvalidCursor)
+		}
+
+		id, err := primitive.ObjectIDFromHex(c.ID)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+
+		// pick up right after the last entry of the previous page
+		filter = append(filter, bson.E{"$or", bson.A{
+			bson.D{{"created_at", bson.D{{compare, c.CreatedAt}}}},
+			bson.D{{"created_at", c.CreatedAt}, {"_id", bson.D{{compare, id}}}},
+		}})
+	}
+
+	// one more than asked, to know whether there's a next page
+	cursor, err := r.mc.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{"created_at", direction}, {"_id", direction}}).
+		SetLimit(int64(p.Limit)+1),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("database query failed: %w", err)
+	}
+
+	defer func() {
+		if err = cursor.Close(ctx); err != nil {
+			slog.Error("Failed to close cursor", "error", err)
+		}
+	}()
+
+	entries := make([]data.Entry, 0, p.Limit)
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, "", fmt.Errorf("data decoding error: %w", err)
+	}
+
+	if len(entries) <= p.Limit {
+		return entries, "", nil
+	}
+
+	entries = entries[:p.Limit]
+	last := entries[len(entries)-1]
+
+	return entries, CursorAfter(last, p.Ascending), nil
+}
+
+// CursorAfter is the cursor of the page starting right after e, in the given sort direction.
+func CursorAfter(e data.Entry, ascending bool) string {
+	return pageCursor{
+		CreatedAt: e.CreatedAt,
+		ID:        e.ID,
+		Ascending: ascending,
+	}.encode()
+}
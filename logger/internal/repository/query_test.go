@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ziliscite/go-micro-logger/internal/data"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		ascending bool
+	}{
+		{"descending", false},
+		{"ascending", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := data.Entry{
+				ID:        "65a1b2c3d4e5f60718293a4b",
+				CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 678_000_000, time.UTC),
+			}
+
+			c, err := decodeCursor(CursorAfter(entry, tt.ascending))
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+
+			if c.ID != entry.ID || !c.CreatedAt.Equal(entry.CreatedAt) || c.Ascending != tt.ascending {
+				t.Errorf("decodeCursor() = %+v, want the ID and time of %+v, ascending %v", c, entry, tt.ascending)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("cursor"))},
+		{"wrong types", base64.RawURLEncoding.EncodeToString([]byte(`{"t":"yesterday","id":1}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
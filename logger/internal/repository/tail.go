@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"github.com/ziliscite/go-micro-logger/internal/data"
+
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// tailBuffer is how many entries a tail holds for a slow reader before it starts dropping them
+const tailBuffer = 256
+
+// hub fans the entries written through the repository out to the tails following them. It only
+// sees the writes of this process, entries written by another instance of the service don't show up.
+type hub struct {
+	mu      sync.Mutex
+	tails   map[*Tail]struct{}
+	stopped bool
+}
+
+func newHub() *hub {
+	return &hub{
+		tails: make(map[*Tail]struct{}),
+	}
+}
+
+// publish hands the entries to the tails they match. It never waits on a reader, a tail with
+// a full buffer misses the entry and counts it as dropped.
+func (h *hub) publish(entries ...data.Entry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for t := range h.tails {
+		for _, entry := range entries {
+			if !t.filter.matches(entry) {
+				continue
+			}
+
+			select {
+			case t.ch <- entry:
+			default:
+				t.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Tail follows the entries written after it started that match its filter.
+type Tail struct {
+	hub    *hub
+	filter Filter
+
+	ch      chan data.Entry
+	dropped atomic.Uint64
+}
+
+// Tail starts following the entries matching f. It must be closed once done with.
+func (r Repository) Tail(f Filter) *Tail {
+	t := &Tail{
+		hub:    r.tails,
+		filter: f,
+		ch:     make(chan data.Entry, tailBuffer),
+	}
+
+	r.tails.mu.Lock()
+	defer r.tails.mu.Unlock()
+
+	if r.tails.stopped {
+		// shutting down, there is nothing left to follow
+		close(t.ch)
+		return t
+	}
+
+	r.tails.tails[t] = struct{}{}
+	return t
+}
+
+// Entries delivers the entries in the order they were written. It's closed when the tail is
+// closed or the tails are stopped.
+func (t *Tail) Entries() <-chan data.Entry {
+	return t.ch
+}
+
+// Dropped is how many entries the tail missed so far because its reader fell behind.
+func (t *Tail) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+func (t *Tail) Close() {
+	t.hub.mu.Lock()
+	defer t.hub.mu.Unlock()
+
+	if _, ok := t.hub.tails[t]; ok {
+		delete(t.hub.tails, t)
+		close(t.ch)
+	}
+}
+
+// StopTails ends every tail, and the ones started after. Tails never end on their own, the
+// servers streaming them can't drain until they're stopped.
+func (r Repository) StopTails() {
+	r.tails.mu.Lock()
+	defer r.tails.mu.Unlock()
+
+	r.tails.stopped = true
+	for t := range r.tails.tails {
+		delete(r.tails.tails, t)
+		close(t.ch)
+	}
+}
+
+// matches tells whether the entry is one f would find.
+func (f Filter) matches(e data.Entry) bool {
+	if !f.From.IsZero() && e.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.CreatedAt.Before(f.To) {
+		return false
+	}
+	if f.Title != "" && e.Title != f.Title {
+		return false
+	}
+	if len(f.Severity) > 0 && !slices.Contains(f.Severity, e.Severity) {
+		return false
+	}
+	if f.Service != "" && e.Service != f.Service {
+		return false
+	}
+	if f.Search != "" && !matchesSearch(f.Search, e.Title+" "+e.Content) {
+		return false
+	}
+
+	return true
+}
+
+// matchesSearch approximates mongo's $text search: any of the terms, every "quoted phrase" and
+// none of the -negated terms, ignoring case. Terms are matched as substrings, without stemming.
+func matchesSearch(search, text string) bool {
+	text = strings.ToLower(text)
+
+	var terms, phrases, negated []string
+	for i, part := range strings.Split(strings.ToLower(search), `"`) {
+		// the odd parts are between quotes
+		if i%2 == 1 {
+			if part = strings.TrimSpace(part); part != "" {
+				phrases = append(phrases, part)
+			}
+			continue
+		}
+
+		for _, term := range strings.Fields(part) {
+			if strings.HasPrefix(term, "-") {
+				if term = term[1:]; term != "" {
+					negated = append(negated, term)
+				}
+				continue
+			}
+			terms = append(terms, term)
+		}
+	}
+
+	for _, term := range negated {
+		if strings.Contains(text, term) {
+			return false
+		}
+	}
+	for _, phrase := range phrases {
+		if !strings.Contains(text, phrase) {
+			return false
+		}
+	}
+
+	if len(terms) == 0 {
+		return true
+	}
+	for _, term := range terms {
+		if strings.Contains(text, term) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ziliscite/go-micro-logger/internal/data"
+)
+
+func TestFilterMatches(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := data.Entry{
+		Title:     "payment",
+		Content:   "Card declined for order 42",
+		Severity:  "WARN",
+		Service:   "billing",
+		CreatedAt: at,
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+
+		{"from is included", Filter{From: at}, true},
+		{"after from", Filter{From: at.Add(-time.Second)}, true},
+		{"before from", Filter{From: at.Add(time.Second)}, false},
+		{"to is excluded", Filter{To: at}, false},
+		{"before to", Filter{To: at.Add(time.Second)}, true},
+		{"within the range", Filter{From: at.Add(-time.Hour), To: at.Add(time.Hour)}, true},
+
+		{"title", Filter{Title: "payment"}, true},
+		{"other title", Filter{Title: "login"}, false},
+		{"any of the severities", Filter{Severity: []string{"ERROR", "WARN"}}, true},
+		{"none of the severities", Filter{Severity: []string{"ERROR"}}, false},
+		{"service", Filter{Service: "billing"}, true},
+		{"other service", Filter{Service: "mailer"}, false},
+
+		{"any of the terms", Filter{Search: "refund DECLINED"}, true},
+		{"none of the terms", Filter{Search: "refund shipped"}, false},
+		{"search covers the title", Filter{Search: "payment"}, true},
+		{"phrase", Filter{Search: `"order 42"`}, true},
+		{"phrase out of order", Filter{Search: `"42 order"`}, false},
+		{"negated term", Filter{Search: "card -declined"}, false},
+		{"only negated terms", Filter{Search: "-refund"}, true},
+
+		{"every field matching", Filter{
+			From:     at.Add(-time.Minute),
+			To:       at.Add(time.Minute),
+			Title:    "payment",
+			Severity: []string{"WARN"},
+			Service:  "billing",
+			Search:   "card",
+		}, true},
+		{"one field off", Filter{
+			From:     at.Add(-time.Minute),
+			Title:    "payment",
+			Severity: []string{"WARN"},
+			Service:  "mailer",
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(entry); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
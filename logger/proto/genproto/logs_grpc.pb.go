@@ -19,14 +19,37 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	LogService_WriteLog_FullMethodName = "/logs.LogService/WriteLog"
+	LogService_WriteLog_FullMethodName   = "/logs.LogService/WriteLog"
+	LogService_WriteLogs_FullMethodName  = "/logs.LogService/WriteLogs"
+	LogService_IngestLogs_FullMethodName = "/logs.LogService/IngestLogs"
+	LogService_GetLog_FullMethodName     = "/logs.LogService/GetLog"
+	LogService_ListLogs_FullMethodName   = "/logs.LogService/ListLogs"
+	LogService_TailLogs_FullMethodName   = "/logs.LogService/TailLogs"
 )
 
 // LogServiceClient is the client API for LogService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Errors come back as gRPC status codes: INVALID_ARGUMENT for a bad entry, id or cursor,
+// NOT_FOUND, ALREADY_EXISTS for a second entry of the same event, DEADLINE_EXCEEDED when
+// mongo is too slow, INTERNAL for everything else.
+//
+// GetLog, ListLogs and TailLogs hand back the audit events too, they take the logger's admin
+// token as "authorization: Bearer <token>" metadata: UNAUTHENTICATED without it, PERMISSION_DENIED
+// with a wrong one.
 type LogServiceClient interface {
 	WriteLog(ctx context.Context, in *LogRequest, opts ...grpc.CallOption) (*LogResponse, error)
+	// WriteLogs writes a batch of at most 1000 entries, each one succeeding or failing on its own
+	WriteLogs(ctx context.Context, in *WriteLogsRequest, opts ...grpc.CallOption) (*WriteLogsResponse, error)
+	// IngestLogs takes entries for as long as the client sends them, written in batches as they come
+	IngestLogs(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Log, IngestLogsResponse], error)
+	GetLog(ctx context.Context, in *GetLogRequest, opts ...grpc.CallOption) (*Entry, error)
+	// ListLogs streams the entries matching the filters, each one with the cursor to resume after it
+	ListLogs(ctx context.Context, in *ListLogsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListLogsResponse], error)
+	// TailLogs streams the entries matching the filters as they're written, until the client leaves.
+	// It ends with UNAVAILABLE when the logger shuts down.
+	TailLogs(ctx context.Context, in *TailLogsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TailLogsResponse], error)
 }
 
 type logServiceClient struct {
@@ -47,11 +70,100 @@ func (c *logServiceClient) WriteLog(ctx context.Context, in *LogRequest, opts ..
 	return out, nil
 }
 
+func (c *logServiceClient) WriteLogs(ctx context.Context, in *WriteLogsRequest, opts ...grpc.CallOption) (*WriteLogsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteLogsResponse)
+	err := c.cc.Invoke(ctx, LogService_WriteLogs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logServiceClient) IngestLogs(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Log, IngestLogsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LogService_ServiceDesc.Streams[0], LogService_IngestLogs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Log, IngestLogsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogService_IngestLogsClient = grpc.ClientStreamingClient[Log, IngestLogsResponse]
+
+func (c *logServiceClient) GetLog(ctx context.Context, in *GetLogRequest, opts ...grpc.CallOption) (*Entry, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Entry)
+	err := c.cc.Invoke(ctx, LogService_GetLog_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logServiceClient) ListLogs(ctx context.Context, in *ListLogsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListLogsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LogService_ServiceDesc.Streams[1], LogService_ListLogs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListLogsRequest, ListLogsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogService_ListLogsClient = grpc.ServerStreamingClient[ListLogsResponse]
+
+func (c *logServiceClient) TailLogs(ctx context.Context, in *TailLogsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TailLogsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LogService_ServiceDesc.Streams[2], LogService_TailLogs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TailLogsRequest, TailLogsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogService_TailLogsClient = grpc.ServerStreamingClient[TailLogsResponse]
+
 // LogServiceServer is the server API for LogService service.
 // All implementations must embed UnimplementedLogServiceServer
 // for forward compatibility.
+//
+// Errors come back as gRPC status codes: INVALID_ARGUMENT for a bad entry, id or cursor,
+// NOT_FOUND, ALREADY_EXISTS for a second entry of the same event, DEADLINE_EXCEEDED when
+// mongo is too slow, INTERNAL for everything else.
+//
+// GetLog, ListLogs and TailLogs hand back the audit events too, they take the logger's admin
+// token as "authorization: Bearer <token>" metadata: UNAUTHENTICATED without it, PERMISSION_DENIED
+// with a wrong one.
 type LogServiceServer interface {
 	WriteLog(context.Context, *LogRequest) (*LogResponse, error)
+	// WriteLogs writes a batch of at most 1000 entries, each one succeeding or failing on its own
+	WriteLogs(context.Context, *WriteLogsRequest) (*WriteLogsResponse, error)
+	// IngestLogs takes entries for as long as the client sends them, written in batches as they come
+	IngestLogs(grpc.ClientStreamingServer[Log, IngestLogsResponse]) error
+	GetLog(context.Context, *GetLogRequest) (*Entry, error)
+	// ListLogs streams the entries matching the filters, each one with the cursor to resume after it
+	ListLogs(*ListLogsRequest, grpc.ServerStreamingServer[ListLogsResponse]) error
+	// TailLogs streams the entries matching the filters as they're written, until the client leaves.
+	// It ends with UNAVAILABLE when the logger shuts down.
+	TailLogs(*TailLogsRequest, grpc.ServerStreamingServer[TailLogsResponse]) error
 	mustEmbedUnimplementedLogServiceServer()
 }
 
@@ -65,6 +177,21 @@ type UnimplementedLogServiceServer struct{}
 func (UnimplementedLogServiceServer) WriteLog(context.Context, *LogRequest) (*LogResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method WriteLog not implemented")
 }
+func (UnimplementedLogServiceServer) WriteLogs(context.Context, *WriteLogsRequest) (*WriteLogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteLogs not implemented")
+}
+func (UnimplementedLogServiceServer) IngestLogs(grpc.ClientStreamingServer[Log, IngestLogsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method IngestLogs not implemented")
+}
+func (UnimplementedLogServiceServer) GetLog(context.Context, *GetLogRequest) (*Entry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLog not implemented")
+}
+func (UnimplementedLogServiceServer) ListLogs(*ListLogsRequest, grpc.ServerStreamingServer[ListLogsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ListLogs not implemented")
+}
+func (UnimplementedLogServiceServer) TailLogs(*TailLogsRequest, grpc.ServerStreamingServer[TailLogsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method TailLogs not implemented")
+}
 func (UnimplementedLogServiceServer) mustEmbedUnimplementedLogServiceServer() {}
 func (UnimplementedLogServiceServer) testEmbeddedByValue()                    {}
 
@@ -104,6 +231,71 @@ func _LogService_WriteLog_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _LogService_WriteLogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteLogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServiceServer).WriteLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogService_WriteLogs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServiceServer).WriteLogs(ctx, req.(*WriteLogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogService_IngestLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LogServiceServer).IngestLogs(&grpc.GenericServerStream[Log, IngestLogsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogService_IngestLogsServer = grpc.ClientStreamingServer[Log, IngestLogsResponse]
+
+func _LogService_GetLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServiceServer).GetLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogService_GetLog_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServiceServer).GetLog(ctx, req.(*GetLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogService_ListLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogServiceServer).ListLogs(m, &grpc.GenericServerStream[ListLogsRequest, ListLogsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogService_ListLogsServer = grpc.ServerStreamingServer[ListLogsResponse]
+
+func _LogService_TailLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TailLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogServiceServer).TailLogs(m, &grpc.GenericServerStream[TailLogsRequest, TailLogsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LogService_TailLogsServer = grpc.ServerStreamingServer[TailLogsResponse]
+
 // LogService_ServiceDesc is the grpc.ServiceDesc for LogService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,7 +307,31 @@ var LogService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "WriteLog",
 			Handler:    _LogService_WriteLog_Handler,
 		},
+		{
+			MethodName: "WriteLogs",
+			Handler:    _LogService_WriteLogs_Handler,
+		},
+		{
+			MethodName: "GetLog",
+			Handler:    _LogService_GetLog_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IngestLogs",
+			Handler:       _LogService_IngestLogs_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ListLogs",
+			Handler:       _LogService_ListLogs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "TailLogs",
+			Handler:       _LogService_TailLogs_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "logs.proto",
 }
@@ -31,7 +31,10 @@ func (app *application) send(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.sending.Add(1)
 	go func() {
+		defer app.sending.Done()
+
 		// In case of panic / unhandled error
 		defer func() {
 			if err := recover(); err != nil {
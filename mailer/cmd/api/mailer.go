@@ -2,11 +2,11 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/vanng822/go-premailer/premailer"
+	"github.com/ziliscite/go-micro-mailer/internal/config"
 	"html/template"
 	"log/slog"
-	"os"
-	"strconv"
 	"time"
 
 	mail "github.com/xhit/go-simple-mail/v2"
@@ -20,27 +20,23 @@ type Mailer struct {
 	FromName    string
 }
 
-func NewMailer() (*Mailer, error) {
-	port, err := strconv.Atoi(os.Getenv("MAIL_PORT"))
-	if err != nil {
-		return nil, err
-	}
-
+func NewMailer(cfg config.Mail) (*Mailer, error) {
 	srv := mail.NewSMTPClient()
-	srv.Username = os.Getenv("MAIL_USERNAME")
-	srv.Password = os.Getenv("MAIL_PASSWORD")
-	srv.Host = os.Getenv("MAIL_HOST")
-	srv.Port = port
+	srv.Username = cfg.Username
+	srv.Password = cfg.Password
+	srv.Host = cfg.Host
+	srv.Port = cfg.Port
 
 	var enc mail.Encryption
-	switch os.Getenv("MAIL_ENCRYPTION") {
+	switch cfg.Encryption {
 	case "ssl":
 		enc = mail.EncryptionSSLTLS
 	case "none", "":
 		enc = mail.EncryptionNone
-	default:
-		// Also the encryption for "tls" type
+	case "tls":
 		enc = mail.EncryptionSTARTTLS
+	default:
+		return nil, fmt.Errorf("unknown mail encryption %q", cfg.Encryption)
 	}
 
 	srv.Encryption = enc
@@ -48,10 +44,10 @@ func NewMailer() (*Mailer, error) {
 	srv.ConnectTimeout = 10 * time.Second
 
 	return &Mailer{
-		FromAddress: os.Getenv("MAIL_FROM_ADDRESS"),
-		FromName:    os.Getenv("MAIL_FROM_NAME"),
+		FromAddress: cfg.FromAddress,
+		FromName:    cfg.FromName,
 		server:      srv,
-		domain:      os.Getenv("MAIL_DOMAIN"),
+		domain:      cfg.Domain,
 	}, nil
 }
 
@@ -1,29 +1,98 @@
 package main
 
 import (
+	"context"
+	"github.com/ziliscite/go-micro-mailer/event"
+	"github.com/ziliscite/go-micro-mailer/internal/config"
+	"github.com/ziliscite/go-micro-mailer/internal/dedup"
 	"log/slog"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
-const ApiPort = "80"
-
 type application struct {
+	cfg    config.Config
 	mailer *Mailer
+
+	// emails queued on mail.send, and where their delivery status is published
+	consumer  *event.Consumer
+	publisher *event.Publisher
+
+	// emails already sent, rabbitmq delivers at least once
+	sent *dedup.Memory
+
+	// emails still being sent, waited for on shutdown
+	sending sync.WaitGroup
 }
 
 func main() {
-	mailer, err := NewMailer()
+	// Stop on ctrl-c and on docker's SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var cfg config.Config
+	if err := config.Load(&cfg, os.Args[1:]); err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Loaded configuration", "config", config.Redacted(cfg))
+
+	mailer, err := NewMailer(cfg.Mail)
 	if err != nil {
 		slog.Error("Failed to get mailer server", "error", err)
 		os.Exit(1)
 	}
 
-	app := application{
-		mailer: mailer,
+	// Connect to rabbitmq, the connection is re-dialed in the background whenever it drops
+	conn, err := event.Dial(cfg.AMQP.URL)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
+	defer conn.Close()
 
-	if err = app.serve(); err != nil {
-		slog.Error("Failed to start server", "error", err)
+	publisher, err := event.NewPublisher(conn, cfg.Queue.Workers, 5*time.Second)
+	if err != nil {
+		slog.Error("Failed to create publisher", "error", err)
 		os.Exit(1)
 	}
+	defer publisher.Close()
+
+	app := &application{
+		cfg:       cfg,
+		mailer:    mailer,
+		publisher: publisher,
+		sent:      dedup.NewMemory(cfg.Queue.SentSize, cfg.Queue.SentTTL),
+	}
+
+	app.consumer, err = event.NewConsumer(conn, event.QueueOptions{
+		Name:          cfg.Queue.Name,
+		Key:           "mail.send",
+		MaxDeliveries: cfg.Queue.MaxDeliveries,
+		RetryDelay:    cfg.Queue.RetryDelay,
+		Workers:       cfg.Queue.Workers,
+	}, app.deliver, app.giveUp)
+	if err != nil {
+		slog.Error("Failed to create consumer", "error", err)
+		os.Exit(1)
+	}
+
+	// Send queued emails next to the http server, losing rabbitmq takes the whole service down
+	go func() {
+		if err := app.consumer.Listen(ctx); err != nil {
+			slog.Error("Stopped consuming emails", "error", err)
+			stop()
+		}
+	}()
+
+	if err = app.serve(ctx); err != nil {
+		slog.Error("Server stopped with an error", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Mailer service stopped")
 }
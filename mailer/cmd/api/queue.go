@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ziliscite/go-micro-mailer/event"
+)
+
+// mailRequest is the payload of the mail.send events the broker publishes.
+type mailRequest struct {
+	From        string `json:"from,omitempty"`
+	To          string `json:"to"`
+	Subject     string `json:"subject,omitempty"`
+	Message     string `json:"message,omitempty"`
+	RequestedBy string `json:"requested_by,omitempty"`
+}
+
+// deliver sends a queued email, failing makes the consumer put it back on the queue for later.
+// An email already sent is acked without being sent again, its status was recorded the first time.
+func (app *application) deliver(ctx context.Context, e event.Envelope) error {
+	if sent, _ := app.sent.Seen(ctx, e.ID); sent {
+		slog.Info("Skipping email already sent", "id", e.ID)
+		return nil
+	}
+
+	var req mailRequest
+	if err := json.Unmarshal(e.Payload, &req); err != nil {
+		return fmt.Errorf("%w: decoding mail request: %v", event.ErrPoison, err)
+	}
+
+	if req.To == "" {
+		return fmt.Errorf("%w: recipient must be provided", event.ErrPoison)
+	}
+
+	email, err := app.mailer.BuildMessage(Message{
+		Data:    req.Message,
+		From:    req.From,
+		To:      req.To,
+		Subject: req.Subject,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = app.mailer.SendMessage(email); err != nil {
+		return err
+	}
+
+	_ = app.sent.Mark(ctx, e.ID)
+	app.recordStatus(e, req, nil)
+	return nil
+}
+
+// giveUp records that a queued email was dead-lettered and will not be sent.
+func (app *application) giveUp(e event.Envelope, err error) {
+	var req mailRequest
+	// a poison message may not have a usable payload, record what we can
+	_ = json.Unmarshal(e.Payload, &req)
+
+	app.recordStatus(e, req, err)
+}
+
+// recordStatus publishes whether an email went through as a log event, so the listener stores
+// it in the logger like every other event.
+func (app *application) recordStatus(e event.Envelope, req mailRequest, sendErr error) {
+	status := struct {
+		ID          string `json:"id"`
+		To          string `json:"to"`
+		RequestedBy string `json:"requested_by,omitempty"`
+		Status      string `json:"status"`
+		Error       string `json:"error,omitempty"`
+	}{
+		ID:          e.ID,
+		To:          req.To,
+		RequestedBy: req.RequestedBy,
+		Status:      "sent",
+	}
+
+	key := "log.INFO"
+	if sendErr != nil {
+		status.Status = "failed"
+		status.Error = sendErr.Error()
+		key = "log.ERROR"
+	}
+
+	content, err := json.Marshal(status)
+	if err != nil {
+		slog.Error("Failed to encode mail status", "error", err)
+		return
+	}
+
+	// same correlation ID as the mail.send event, so the status can be traced back to the request
+	record, err := event.NewEnvelope(key, "mailer", e.CorrelationID, struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	}{"mail", string(content)})
+	if err != nil {
+		slog.Error("Failed to encode mail status", "error", err)
+		return
+	}
+
+	if err = app.publisher.Publish(context.Background(), record); err != nil {
+		slog.Error("Failed to record mail status", "id", e.ID, "status", status.Status, "error", errors.Join(err, sendErr))
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5/middleware"
 	"log/slog"
@@ -30,12 +32,57 @@ func (app *application) routes() http.Handler {
 	return middleware.Recoverer(mux)
 }
 
-func (app *application) serve() error {
+// serve runs the server until ctx is done, then stops accepting connections and waits for
+// in-flight requests, queued emails being sent and the emails requests queued, for at most the
+// shutdown timeout.
+func (app *application) serve(ctx context.Context) error {
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", ApiPort),
+		Addr:    fmt.Sprintf(":%s", app.cfg.Port),
 		Handler: app.routes(),
 	}
 
-	slog.Info("Starting mailer service", "port", ApiPort)
-	return server.ListenAndServe()
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Starting mailer service", "port", app.cfg.Port)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down mailer service", "timeout", app.cfg.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("draining requests: %w", err)
+	}
+
+	// ListenAndServe returns ErrServerClosed right away once Shutdown is called
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// emails taken off the queue are sent or go back on it
+	if err := app.consumer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("draining the mail queue: %w", err)
+	}
+
+	// no request is left to queue another email, so it's safe to wait now
+	sent := make(chan struct{})
+	go func() {
+		app.sending.Wait()
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("draining emails: %w", ctx.Err())
+	}
 }
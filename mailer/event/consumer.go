@@ -0,0 +1,257 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrPoison marks a message that will never be handled, no matter how many times it's retried.
+// Those are dead-lettered right away.
+var ErrPoison = errors.New("message can't be handled")
+
+// consumerTag names our consumer on the channel, so it can be cancelled on shutdown
+const consumerTag = "mailer"
+
+// HandlerFunc handles one event. Returning an error wrapping ErrPoison dead-letters it, any
+// other error puts it back on the queue for another try.
+type HandlerFunc func(ctx context.Context, e Envelope) error
+
+// QueueOptions describe the durable queue the consumer reads from.
+type QueueOptions struct {
+	Name string
+	// Key is the routing key the queue is bound with
+	Key string
+	// MaxDeliveries is how many times a message is tried before it's dead-lettered
+	MaxDeliveries int
+	// RetryDelay is how long a failed message is held before it goes back on the queue
+	RetryDelay time.Duration
+	// Workers is how many messages are handled at the same time, and how many rabbitmq hands us
+	Workers int
+}
+
+// Consumer handles the messages of a single durable queue, acking them once handled.
+type Consumer struct {
+	conn  *Connection
+	ch    *amqp.Channel // acks must go through the channel the deliveries came from
+	queue QueueOptions
+
+	handler HandlerFunc
+	// giveUp is told about every message that gets dead-lettered, and why. The envelope is empty
+	// when the message couldn't even be decoded.
+	giveUp func(e Envelope, err error)
+
+	// workers still running, waited for on shutdown
+	handling sync.WaitGroup
+	// closed once Listen returns, no workers are started after that
+	stopped chan struct{}
+}
+
+func NewConsumer(conn *Connection, queue QueueOptions, handler HandlerFunc, giveUp func(e Envelope, err error)) (*Consumer, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer channel.Close()
+
+	if err = declareExchange(channel); err != nil {
+		return nil, err
+	}
+
+	if err = declareDeadLetter(channel); err != nil {
+		return nil, err
+	}
+
+	return &Consumer{
+		conn:    conn,
+		queue:   queue,
+		handler: handler,
+		giveUp:  giveUp,
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+// Listen consumes the queue until ctx is done. It then stops taking deliveries and returns,
+// call Shutdown to wait for the messages already taken to be handled.
+//
+// When the connection drops, Listen waits for it to come back and starts over, declaring and binding
+// everything again. Deliveries that weren't acked yet are handed out again by rabbitmq.
+func (c *Consumer) Listen(ctx context.Context) error {
+	defer close(c.stopped)
+
+	backOff := time.Second
+	for {
+		consumed, err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+
+		if consumed {
+			backOff = time.Second
+		}
+
+		slog.Warn("Stopped consuming, resuming once rabbitmq is back", "queue", c.queue.Name, "error", err, "retry_in", backOff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backOff):
+		}
+		backOff = min(backOff*2, maxBackoff)
+
+		if err = c.conn.Ready(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// consume runs one session on a fresh channel, until ctx is done or the channel is lost. It
+// reports whether it got as far as consuming.
+func (c *Consumer) consume(ctx context.Context) (bool, error) {
+	// get a channel, closed by Shutdown once every delivery is acked
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return false, err
+	}
+	c.ch = ch
+
+	workers := max(c.queue.Workers, 1)
+	if err = ch.Qos(workers, 0, false); err != nil {
+		return false, err
+	}
+
+	// rabbitmq may have come back without them
+	if err = declareExchange(ch); err != nil {
+		return false, err
+	}
+
+	if err = declareDeadLetter(ch); err != nil {
+		return false, err
+	}
+
+	q, err := declareQueue(ch, c.queue.Name, c.queue.MaxDeliveries)
+	if err != nil {
+		return false, err
+	}
+
+	if err = bindQueueToExchange(ch, q.Name, c.queue.Key); err != nil {
+		return false, err
+	}
+
+	msgs, err := ch.Consume(
+		q.Name,      // queue
+		consumerTag, // consumer
+		false,       // auto-ack, we ack once the message is handled
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
+	)
+	if err != nil {
+		return false, err
+	}
+
+	var session sync.WaitGroup
+	for range workers {
+		c.handling.Add(1)
+		session.Add(1)
+		go func() {
+			defer c.handling.Done()
+			defer session.Done()
+
+			for m := range msgs {
+				c.handle(m)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		session.Wait()
+		close(done)
+	}()
+
+	slog.Info("Consuming queue", "queue", q.Name, "key", c.queue.Key, "workers", workers)
+
+	select {
+	case <-done:
+		return true, errors.New("rabbitmq closed the delivery channel")
+	case <-ctx.Done():
+	}
+
+	// stop deliveries, the workers finish the ones already sent our way, see Shutdown
+	return true, ch.Cancel(consumerTag, false)
+}
+
+// Shutdown waits for the workers to handle the messages Listen already took, for as long as ctx allows.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	// Listen may still be setting up a session, wait for it to give up before counting workers
+	select {
+	case <-c.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	handled := make(chan struct{})
+	go func() {
+		c.handling.Wait()
+		close(handled)
+	}()
+
+	var err error
+	select {
+	case <-handled:
+	case <-ctx.Done():
+		// whatever is left unacked goes back on the queue when the channel closes
+		err = ctx.Err()
+	}
+
+	// the channel is already gone if the connection dropped
+	if c.ch != nil && !c.ch.IsClosed() {
+		err = errors.Join(err, c.ch.Close())
+	}
+
+	return err
+}
+
+// handle acks the delivery once it's handled. Failed ones are put back on the queue after a
+// while, poison ones and the ones on their last delivery are dead-lettered.
+func (c *Consumer) handle(m amqp.Delivery) {
+	e, err := Decode(m)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrPoison, err)
+	} else {
+		err = c.handler(context.Background(), e)
+	}
+
+	// quorum queues count the deliveries for us
+	deliveries, _ := m.Headers["x-delivery-count"].(int64)
+	last := c.queue.MaxDeliveries > 0 && deliveries+1 >= int64(c.queue.MaxDeliveries)
+
+	switch {
+	case err == nil:
+		err = m.Ack(false)
+	case errors.Is(err, ErrPoison) || last:
+		slog.Error("Dead-lettering message", "routing_key", m.RoutingKey, "message_id", m.MessageId, "deliveries", deliveries+1, "error", err)
+		if c.giveUp != nil {
+			c.giveUp(e, err)
+		}
+		err = m.Nack(false, false)
+	default:
+		slog.Warn("Failed to handle message, retrying", "routing_key", m.RoutingKey, "message_id", m.MessageId, "delivery", deliveries+1, "max_deliveries", c.queue.MaxDeliveries, "error", err)
+		time.Sleep(c.queue.RetryDelay)
+		err = m.Nack(false, true)
+	}
+
+	if err != nil {
+		slog.Error("Failed to settle delivery", "error", err)
+	}
+}
@@ -0,0 +1,157 @@
+package event
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Version is the envelope version this service writes. When the envelope changes, bump it and
+// add an upgrade from the previous version, so messages still in the queues keep working.
+const Version = 1
+
+var ErrInvalidEnvelope = errors.New("invalid event envelope")
+
+// Envelope wraps every message published on the exchange. Its type doubles as the routing key.
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Source        string          `json:"source"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// NewEnvelope wraps payload in an envelope of the current version. The correlation ID ties
+// together the events caused by the same request, and may be empty.
+func NewEnvelope(typ, source, correlationID string, payload any) (Envelope, error) {
+	p, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	id, err := NewID()
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		ID:            id,
+		Type:          typ,
+		Version:       Version,
+		Timestamp:     time.Now().UTC(),
+		Source:        source,
+		CorrelationID: correlationID,
+		Payload:       p,
+	}, nil
+}
+
+// Validate checks the envelope has everything a consumer relies on.
+func (e Envelope) Validate() error {
+	var missing []string
+	if e.ID == "" {
+		missing = append(missing, "id")
+	}
+	if e.Type == "" {
+		missing = append(missing, "type")
+	}
+	if e.Timestamp.IsZero() {
+		missing = append(missing, "timestamp")
+	}
+	if e.Source == "" {
+		missing = append(missing, "source")
+	}
+	if len(e.Payload) == 0 {
+		missing = append(missing, "payload")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrInvalidEnvelope, strings.Join(missing, ", "))
+	}
+
+	if e.Version != Version {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidEnvelope, e.Version)
+	}
+
+	if !json.Valid(e.Payload) {
+		return fmt.Errorf("%w: payload is not valid json", ErrInvalidEnvelope)
+	}
+
+	return nil
+}
+
+// Decode reads the envelope of a delivery, upgrading it to the current version.
+func Decode(d amqp.Delivery) (Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(d.Body, &e); err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+
+	// messages from before the envelope have no version, the whole body is their payload
+	if e.Version == 0 {
+		e = Envelope{Payload: d.Body}
+	}
+
+	if e.Version > Version {
+		return Envelope{}, fmt.Errorf("%w: version %d is newer than %d", ErrInvalidEnvelope, e.Version, Version)
+	}
+
+	for e.Version < Version {
+		upgrade, ok := upgrades[e.Version]
+		if !ok {
+			return Envelope{}, fmt.Errorf("%w: no upgrade from version %d", ErrInvalidEnvelope, e.Version)
+		}
+
+		if err := upgrade(&e, d); err != nil {
+			return Envelope{}, fmt.Errorf("%w: upgrading from version %d: %v", ErrInvalidEnvelope, e.Version, err)
+		}
+	}
+
+	return e, e.Validate()
+}
+
+// upgrades bring an envelope from the version it's keyed by to the next one.
+var upgrades = map[int]func(e *Envelope, d amqp.Delivery) error{
+	// bare {title, content} payloads published as text/plain, the delivery knows the rest
+	0: func(e *Envelope, d amqp.Delivery) error {
+		e.ID = d.MessageId
+		if e.ID == "" {
+			id, err := NewID()
+			if err != nil {
+				return err
+			}
+			e.ID = id
+		}
+
+		e.Type = d.RoutingKey
+		e.Timestamp = d.Timestamp
+		if e.Timestamp.IsZero() {
+			e.Timestamp = time.Now().UTC()
+		}
+
+		e.Source = d.AppId
+		if e.Source == "" {
+			e.Source = "unknown"
+		}
+
+		e.CorrelationID = d.CorrelationId
+		e.Version = 1
+		return nil
+	},
+}
+
+// NewID makes a random event ID, the kind envelopes get.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
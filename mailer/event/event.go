@@ -0,0 +1,90 @@
+package event
+
+import amqp "github.com/rabbitmq/amqp091-go"
+
+// Declare exchange for pub/sub, the same one the broker and the listener use
+func declareExchange(channel *amqp.Channel) error {
+	// Declare an exchange
+	return channel.ExchangeDeclare(
+		"logs_topic", // name of the exchange
+		"topic",      // type
+		true,         // durable? yes, it supposed to last
+		false,        // auto-deleted
+		false,        // internal, no, its gonna be used between microservice
+		false,        // no-wait
+		nil,          // arguments
+	)
+}
+
+// deadLetterExchange receives the events we gave up on, and routes them to deadLetterQueue
+const (
+	deadLetterExchange = "logs_dlx"
+	deadLetterQueue    = "logs.dead"
+)
+
+// Declare the dead-letter exchange and the queue that keeps poison messages around for inspection
+func declareDeadLetter(channel *amqp.Channel) error {
+	err := channel.ExchangeDeclare(
+		deadLetterExchange, // name of the exchange
+		"fanout",           // type, everything dead ends up in the same place
+		true,               // durable
+		false,              // auto-deleted
+		false,              // internal
+		false,              // no-wait
+		nil,                // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err = channel.QueueDeclare(
+		deadLetterQueue, // name of the queue
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive
+		false,           // no-wait
+		amqp.Table{amqp.QueueTypeArg: amqp.QueueTypeQuorum},
+	); err != nil {
+		return err
+	}
+
+	return channel.QueueBind(
+		deadLetterQueue,    // name of the queue
+		"",                 // routing key, ignored by fanout
+		deadLetterExchange, // exchange
+		false,              // no-wait
+		nil,                // arguments
+	)
+}
+
+// Declare a named, durable quorum queue, so queued emails survive the mailer restarting
+//
+// Once a message is delivered maxDeliveries times without being acked, it is moved to the
+// dead-letter exchange.
+func declareQueue(channel *amqp.Channel, name string, maxDeliveries int) (amqp.Queue, error) {
+	return channel.QueueDeclare(
+		name,  // name of the queue
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive, other mailer replicas share the work
+		false, // no-wait
+		amqp.Table{
+			amqp.QueueTypeArg:        amqp.QueueTypeQuorum,
+			"x-delivery-limit":       maxDeliveries,
+			"x-dead-letter-exchange": deadLetterExchange,
+			// at-least-once dead-lettering needs reject-publish, so nothing is dropped on the way
+			"x-dead-letter-strategy": "at-least-once",
+			amqp.QueueOverflowArg:    amqp.QueueOverflowRejectPublish,
+		},
+	)
+}
+
+func bindQueueToExchange(channel *amqp.Channel, queueName, key string) error {
+	return channel.QueueBind(
+		queueName,    // name of the queue
+		key,          // routing key
+		"logs_topic", // exchange
+		false,        // no-wait
+		nil,          // arguments
+	)
+}
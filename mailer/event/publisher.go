@@ -0,0 +1,206 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// ErrUnroutable means no queue is bound for the routing key, rabbitmq would have dropped it
+	ErrUnroutable = errors.New("message could not be routed to any queue")
+	// ErrNacked means rabbitmq took the message but could not store it
+	ErrNacked = errors.New("message was rejected by rabbitmq")
+)
+
+// Publisher publishes on long-lived channels in confirm mode, so Push only reports success once
+// rabbitmq has taken responsibility for the message.
+//
+// Channels are pooled, each one is used by a single Push at a time. That's what lets a returned
+// message be matched with the Push it belongs to: rabbitmq sends the return before the confirm.
+//
+// Channels broken by a lost connection are opened again once it's back, the exchange is declared
+// again on each new channel in case rabbitmq came back without it.
+type Publisher struct {
+	conn    *Connection
+	timeout time.Duration
+
+	// pool holds idle channels, nil ones stand for channels not opened yet or thrown away
+	pool chan *confirmChannel
+}
+
+type confirmChannel struct {
+	ch      *amqp.Channel
+	returns chan amqp.Return
+}
+
+// NewPublisher creates a publisher with up to size channels, waiting at most timeout for each
+// message to be confirmed.
+func NewPublisher(conn *Connection, size int, timeout time.Duration) (*Publisher, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer channel.Close()
+
+	err = declareExchange(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	size = max(size, 1)
+	pool := make(chan *confirmChannel, size)
+	for range size {
+		pool <- nil
+	}
+
+	return &Publisher{
+		conn:    conn,
+		timeout: timeout,
+		pool:    pool,
+	}, nil
+}
+
+// Publish sends the envelope, routed by its type, and waits for rabbitmq to confirm it. It fails
+// with ErrUnroutable when no queue is bound for the type.
+func (p *Publisher) Publish(ctx context.Context, e Envelope) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	c, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	confirm, err := c.ch.PublishWithDeferredConfirmWithContext(ctx,
+		"logs_topic", // the same exchange in the consumer
+		e.Type,       // routing key
+		true,         // mandatory, return it to us instead of dropping it when nothing is bound
+		false,        // immediate
+		amqp.Publishing{
+			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
+			MessageId:     e.ID,
+			Type:          e.Type,
+			Timestamp:     e.Timestamp,
+			AppId:         e.Source,
+			CorrelationId: e.CorrelationID,
+			Body:          body,
+		},
+	)
+	if err != nil {
+		p.release(c, true)
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		// a late return would be taken for the next message's, don't reuse the channel
+		p.release(c, true)
+		return fmt.Errorf("waiting for confirmation: %w", err)
+	}
+
+	if !acked {
+		// a nacked message may have been returned too, don't leave it for the next one
+		select {
+		case <-c.returns:
+		default:
+		}
+
+		p.release(c, c.ch.IsClosed())
+		return ErrNacked
+	}
+
+	// the return, if any, came in before the confirm
+	select {
+	case ret := <-c.returns:
+		p.release(c, false)
+		return fmt.Errorf("%w: %s (%d)", ErrUnroutable, ret.ReplyText, ret.ReplyCode)
+	default:
+	}
+
+	p.release(c, false)
+	return nil
+}
+
+// Close closes every idle channel. Pushes still running keep theirs until they're done.
+func (p *Publisher) Close() error {
+	var errs []error
+	for {
+		select {
+		case c := <-p.pool:
+			if c != nil {
+				errs = append(errs, c.ch.Close())
+			}
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+func (p *Publisher) acquire(ctx context.Context) (*confirmChannel, error) {
+	var c *confirmChannel
+	select {
+	case c = <-p.pool:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a channel: %w", ctx.Err())
+	}
+
+	if c != nil && !c.ch.IsClosed() {
+		return c, nil
+	}
+
+	c, err := p.open()
+	if err != nil {
+		p.pool <- nil
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (p *Publisher) release(c *confirmChannel, broken bool) {
+	if broken {
+		_ = c.ch.Close()
+		p.pool <- nil
+		return
+	}
+
+	p.pool <- c
+}
+
+func (p *Publisher) open() (*confirmChannel, error) {
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = declareExchange(ch); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+
+	if err = ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+
+	return &confirmChannel{
+		ch: ch,
+		// only one message is in flight per channel, so one return at most
+		returns: ch.NotifyReturn(make(chan amqp.Return, 1)),
+	}, nil
+}
@@ -5,6 +5,10 @@ go 1.23.4
 require (
 	github.com/go-chi/chi/v5 v5.2.0
 	github.com/go-chi/cors v1.2.1
+	github.com/rabbitmq/amqp091-go v1.10.0
+	github.com/vanng822/go-premailer v1.23.0
+	github.com/xhit/go-simple-mail/v2 v2.16.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -13,7 +17,5 @@ require (
 	github.com/gorilla/css v1.0.1 // indirect
 	github.com/toorop/go-dkim v0.0.0-20201103131630-e1cd1a0a5208 // indirect
 	github.com/vanng822/css v1.0.1 // indirect
-	github.com/vanng822/go-premailer v1.23.0 // indirect
-	github.com/xhit/go-simple-mail/v2 v2.16.0 // indirect
 	golang.org/x/net v0.34.0 // indirect
 )
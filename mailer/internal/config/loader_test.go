@@ -0,0 +1,159 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Name    string        `yaml:"name" env:"TEST_CONFIG_NAME" flag:"name" default:"default"`
+	Timeout time.Duration `yaml:"timeout" env:"TEST_CONFIG_TIMEOUT" default:"1s"`
+	Tags    []string      `yaml:"tags" env:"TEST_CONFIG_TAGS"`
+
+	DB struct {
+		URL      string `yaml:"url" env:"TEST_CONFIG_DB_URL" required:"true"`
+		Password string `yaml:"password" env:"TEST_CONFIG_DB_PASSWORD" secret:"true"`
+		Token    string `yaml:"token" secret:"true"`
+	} `yaml:"db"`
+}
+
+// writeFile writes a YAML config file and points CONFIG_FILE at it.
+func writeFile(t *testing.T, content string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"default", "", nil, nil, "default"},
+		{"file over default", "name: file", nil, nil, "file"},
+		{"env over file", "name: file", map[string]string{"TEST_CONFIG_NAME": "env"}, nil, "env"},
+		{"flag over env", "name: file", map[string]string{"TEST_CONFIG_NAME": "env"}, []string{"-name", "flag"}, "flag"},
+		{"empty env still counts", "name: file", map[string]string{"TEST_CONFIG_NAME": ""}, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("TEST_CONFIG_DB_URL", "postgres://db")
+			if tt.file != "" {
+				writeFile(t, tt.file)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			var cfg testConfig
+			if err := Load(&cfg, tt.args); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if cfg.Name != tt.want {
+				t.Errorf("Name = %q, want %q", cfg.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTypes(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("TEST_CONFIG_DB_URL", "postgres://db")
+	t.Setenv("TEST_CONFIG_TIMEOUT", "250ms")
+	t.Setenv("TEST_CONFIG_TAGS", "a, b,,c")
+
+	var cfg testConfig
+	if err := Load(&cfg, nil); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Timeout != 250*time.Millisecond {
+		t.Errorf("Timeout = %s, want 250ms", cfg.Timeout)
+	}
+	if strings.Join(cfg.Tags, "|") != "a|b|c" {
+		t.Errorf("Tags = %q, want [a b c]", cfg.Tags)
+	}
+}
+
+func TestLoadRequired(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+
+	var cfg testConfig
+	err := Load(&cfg, nil)
+	if err == nil {
+		t.Fatal("Load() succeeded without a required setting")
+	}
+
+	if !strings.Contains(err.Error(), "db.url (env TEST_CONFIG_DB_URL)") {
+		t.Errorf("Load() error = %q, want it to name db.url and its env var", err)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{"unknown key in the file", "nmae: typo", nil},
+		{"bad duration", "", map[string]string{"TEST_CONFIG_TIMEOUT": "soon"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("TEST_CONFIG_DB_URL", "postgres://db")
+			if tt.file != "" {
+				writeFile(t, tt.file)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			var cfg testConfig
+			if err := Load(&cfg, nil); err == nil {
+				t.Error("Load() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	var cfg testConfig
+	cfg.Name = "service"
+	cfg.DB.URL = "postgres://db"
+	cfg.DB.Password = "hunter2"
+
+	got := Redacted(cfg)
+
+	want := map[string]any{
+		"name":        "service",
+		"db.url":      "postgres://db",
+		"db.password": "[redacted]",
+		"db.token":    "",
+	}
+	for path, v := range want {
+		if got[path] != v {
+			t.Errorf("Redacted()[%q] = %v, want %v", path, got[path], v)
+		}
+	}
+
+	for path, v := range got {
+		if s, ok := v.(string); ok && strings.Contains(s, "hunter2") {
+			t.Errorf("Redacted()[%q] leaks the secret", path)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package dedup remembers which emails were already sent, so a redelivered mail.send event is
+// acked without the email going out twice.
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an LRU of at most size IDs that each expire after ttl. It's a best effort, the IDs
+// are forgotten on restart and aren't shared with the other replicas of the mailer.
+type Memory struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	order *list.List // front is the most recently used
+	ids   map[string]*list.Element
+}
+
+type memoryEntry struct {
+	id      string
+	expires time.Time
+}
+
+func NewMemory(size int, ttl time.Duration) *Memory {
+	return &Memory{
+		size:  max(size, 1),
+		ttl:   ttl,
+		order: list.New(),
+		ids:   make(map[string]*list.Element),
+	}
+}
+
+func (m *Memory) Seen(_ context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.ids[id]
+	if !ok {
+		return false, nil
+	}
+
+	if time.Now().After(el.Value.(*memoryEntry).expires) {
+		m.remove(el)
+		return false, nil
+	}
+
+	m.order.MoveToFront(el)
+	return true, nil
+}
+
+func (m *Memory) Mark(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires := time.Now().Add(m.ttl)
+
+	if el, ok := m.ids[id]; ok {
+		el.Value.(*memoryEntry).expires = expires
+		m.order.MoveToFront(el)
+		return nil
+	}
+
+	m.ids[id] = m.order.PushFront(&memoryEntry{id: id, expires: expires})
+
+	for m.order.Len() > m.size {
+		m.remove(m.order.Back())
+	}
+
+	return nil
+}
+
+func (m *Memory) Close(context.Context) error {
+	return nil
+}
+
+func (m *Memory) remove(el *list.Element) {
+	m.order.Remove(el)
+	delete(m.ids, el.Value.(*memoryEntry).id)
+}